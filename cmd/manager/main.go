@@ -17,6 +17,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 
 	"k8s.io/klog"
@@ -34,6 +35,24 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		if err := simulate(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error running simulation: %v\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "override" {
+		if err := override(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error setting override: %v\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	klog.InitFlags(nil)
 
 	flag.StringVar(&nginx.Template, "nginx-tempĺate", nginx.Template, "NGINX template to use.")
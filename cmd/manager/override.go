@@ -0,0 +1,111 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+const overrideUsage = "usage: override <pause|resume|keep-awake|force-sleep|clear> --namespace <namespace> --deployment <name> [--for <duration> | --until <RFC3339>]"
+
+// override sets or removes the annotations of a deployment that override
+// the decisions of the policies of the proxy
+func override(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(overrideUsage)
+	}
+
+	action := args[0]
+
+	flags := flag.NewFlagSet("override", flag.ExitOnError)
+
+	namespace := flags.String("namespace", "default", "Namespace of the deployment.")
+	deployment := flags.String("deployment", "", "Deployment handled by the proxy.")
+	duration := flags.Duration("for", time.Hour, "Time the deployment is kept awake (keep-awake).")
+	until := flags.String("until", "", "Time (RFC3339) until the deployment is kept awake (keep-awake). Takes precedence over --for.")
+
+	flags.Parse(args[1:])
+
+	if *deployment == "" {
+		return fmt.Errorf("the flag --deployment is required")
+	}
+
+	// null removes the annotation
+	annotations := map[string]interface{}{}
+
+	switch action {
+	case "pause":
+		annotations[scaler.PausedAnnotation] = "true"
+	case "resume":
+		annotations[scaler.PausedAnnotation] = nil
+	case "keep-awake":
+		keepAwakeUntil := time.Now().Add(*duration)
+		if *until != "" {
+			t, err := time.Parse(time.RFC3339, *until)
+			if err != nil {
+				return fmt.Errorf("invalid time %v: %v", *until, err)
+			}
+
+			keepAwakeUntil = t
+		}
+
+		annotations[scaler.KeepAwakeUntilAnnotation] = keepAwakeUntil.UTC().Format(time.RFC3339)
+	case "force-sleep":
+		annotations[scaler.ForceSleepAnnotation] = "true"
+	case "clear":
+		annotations[scaler.PausedAnnotation] = nil
+		annotations[scaler.KeepAwakeUntilAnnotation] = nil
+		annotations[scaler.ForceSleepAnnotation] = nil
+	default:
+		return fmt.Errorf("invalid action %v (%v)", action, overrideUsage)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.AppsV1().Deployments(*namespace).Patch(*deployment, types.MergePatchType, patch)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("deployment %v/%v: %v\n", *namespace, *deployment, action)
+	return nil
+}
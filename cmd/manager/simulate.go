@@ -0,0 +1,146 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/policy"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+// simulate replays a recorded traffic trace with the configuration of the
+// proxy and reports the predicted cold starts and replica hours saved
+func simulate(args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+
+	trace := flags.String("trace", "", "File with the recorded traffic trace (one request per line: time [duration in seconds]).")
+	config := flags.String("config", "", "File with the configuration of the proxy as environment variables (PROXY_*=value). Defaults to the environment.")
+	interval := flags.Duration("interval", 5*time.Second, "Time between evaluations of the scaling policies.")
+	activationDelay := flags.Duration("activation-delay", 30*time.Second, "Time the deployment takes to be ready after a scale from zero.")
+	replicas := flags.Int("replicas", 1, "Replicas of the deployment without scaling to zero.")
+	output := flags.String("output", "text", "Format of the report (text or json).")
+
+	flags.Parse(args)
+
+	if *trace == "" {
+		return fmt.Errorf("the flag --trace is required")
+	}
+
+	if *config != "" {
+		if err := loadEnvFile(*config); err != nil {
+			return err
+		}
+	}
+
+	// the target is not used in the simulation
+	for _, name := range []string{"PROXY_NAMESPACE", "PROXY_DEPLOYMENT", "PROXY_SERVICE"} {
+		if os.Getenv(name) == "" {
+			os.Setenv(name, "simulation")
+		}
+	}
+
+	spec, err := env.Parse()
+	if err != nil {
+		return err
+	}
+
+	scalingPolicy, err := policy.New(spec)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(*trace)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	requests, err := scaler.ParseTrace(f)
+	if err != nil {
+		return fmt.Errorf("reading trace %v: %v", *trace, err)
+	}
+
+	s := &scaler.Simulation{
+		Policy:          scalingPolicy,
+		Retention:       spec.IdleWindow,
+		Interval:        *interval,
+		ActivationDelay: *activationDelay,
+		Replicas:        int32(*replicas),
+		Activation:      scaler.NewActivation(spec),
+		Stabilization:   scaler.NewStabilization(spec),
+	}
+
+	report, err := s.Run(requests)
+	if err != nil {
+		return err
+	}
+
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "text":
+		fmt.Printf("Policy:                 %v\n", scalingPolicy.Name())
+		fmt.Printf("Period:                 %v - %v (%v)\n", report.Start.UTC().Format(time.RFC3339), report.End.UTC().Format(time.RFC3339), report.End.Sub(report.Start))
+		fmt.Printf("Requests:               %v\n", report.Requests)
+		fmt.Printf("Cold starts:            %v\n", report.ColdStarts)
+		fmt.Printf("Avoided cold starts:    %v\n", report.AvoidedColdStarts)
+		fmt.Printf("Held requests:          %v\n", report.HeldRequests)
+		fmt.Printf("Maximum held wait:      %v\n", report.MaxHeldWait)
+		fmt.Printf("Wakes / sleeps:         %v / %v\n", report.Wakes, report.Sleeps)
+		fmt.Printf("Replica hours:          %.2f\n", report.ReplicaHours)
+		fmt.Printf("Baseline replica hours: %.2f\n", report.BaselineReplicaHours)
+		fmt.Printf("Replica hours saved:    %.2f\n", report.ReplicaHoursSaved)
+		return nil
+	default:
+		return fmt.Errorf("invalid output format %v (valid: text and json)", *output)
+	}
+}
+
+// loadEnvFile sets the environment variables defined in a file with the format NAME=value
+func loadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid line in %v: %q (expected NAME=value)", path, line)
+		}
+
+		os.Setenv(strings.TrimSpace(parts[0]), strings.Trim(strings.TrimSpace(parts[1]), `"'`))
+	}
+
+	return scanner.Err()
+}
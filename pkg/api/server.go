@@ -0,0 +1,253 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+	"github.com/aledbf/horus-proxy/pkg/policy"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+var log = logf.Log.WithName("controller").WithName("api")
+
+const (
+	// defaultWaitTimeout maximum time a request waits for the deployment by default
+	defaultWaitTimeout = 5 * time.Minute
+
+	// waitInterval time between checks of the endpoints of the deployment
+	waitInterval = time.Second
+)
+
+// Response is the result of a request to wake or sleep the deployment
+type Response struct {
+	// Action requested (Wake or Sleep)
+	Action policy.Action `json:"action"`
+	// Replicas minimum number of replicas requested
+	Replicas int32 `json:"replicas,omitempty"`
+	// Until time the deployment is kept awake
+	Until *time.Time `json:"until,omitempty"`
+	// Ready is true if the deployment reached the requested state. Only set waiting for the deployment
+	Ready bool `json:"ready"`
+	// Endpoints number of ready endpoints of the deployment
+	Endpoints int `json:"endpoints"`
+}
+
+// Server exposes an authenticated HTTP API to wake or sleep the deployment on demand
+type Server struct {
+	demand    func(scaler.Demand) error
+	collector *metrics.Collector
+	token     string
+}
+
+// NewServer returns an API server that requests the demands using the demand function.
+// Requests must use the token in the Authorization header (Bearer)
+func NewServer(demand func(scaler.Demand) error, collector *metrics.Collector, token string) *Server {
+	return &Server{
+		demand:    demand,
+		collector: collector,
+		token:     token,
+	}
+}
+
+// Handler returns the HTTP handler of the API (POST /wake and POST /sleep)
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/wake", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		replicas := int32(1)
+		if value := r.URL.Query().Get("replicas"); value != "" {
+			n, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || n < 1 {
+				http.Error(w, fmt.Sprintf("invalid replicas %v", value), http.StatusBadRequest)
+				return
+			}
+
+			replicas = int32(n)
+		}
+
+		duration, err := durationParam(r, "for", scaler.DefaultDemandDuration)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		wait, timeout, err := waitParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		until := time.Now().Add(duration)
+		err = s.demand(scaler.Demand{Action: policy.Wake, Replicas: replicas, Until: until, Source: "api"})
+		if err != nil {
+			demandError(w, err)
+			return
+		}
+
+		log.Info("Wake requested", "replicas", replicas, "until", until, "client", r.RemoteAddr)
+
+		s.respond(w, r, wait, timeout, &Response{Action: policy.Wake, Replicas: replicas, Until: &until}, func(endpoints int) bool {
+			return endpoints >= int(replicas)
+		})
+	}))
+
+	mux.HandleFunc("/sleep", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		wait, timeout, err := waitParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = s.demand(scaler.Demand{Action: policy.Sleep, Source: "api"})
+		if err != nil {
+			demandError(w, err)
+			return
+		}
+
+		log.Info("Sleep requested", "client", r.RemoteAddr)
+
+		s.respond(w, r, wait, timeout, &Response{Action: policy.Sleep}, func(endpoints int) bool {
+			return endpoints == 0
+		})
+	}))
+
+	return mux
+}
+
+// demandError writes the error of a demand. Demands rejected by an override return 409
+func demandError(w http.ResponseWriter, err error) {
+	if _, ok := err.(*scaler.RejectedDemandError); ok {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// authenticated rejects the requests without the token or not using POST
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// respond writes the response, waiting until the deployment is ready if required.
+// Returns 202 without waiting and 504 if the deployment was not ready before the timeout
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, wait bool, timeout time.Duration, response *Response, ready func(endpoints int) bool) {
+	status := http.StatusAccepted
+	if wait {
+		status = http.StatusGatewayTimeout
+		response.Endpoints, response.Ready = s.waitFor(r.Context(), timeout, ready)
+		if response.Ready {
+			status = http.StatusOK
+		}
+	} else {
+		response.Endpoints = s.collector.CurrentStats().EndpointCount
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error(err, "encoding API response")
+	}
+}
+
+// waitFor checks the endpoints of the deployment until they are ready, the timeout
+// expires or the client disconnects. Returns the last number of endpoints
+func (s *Server) waitFor(ctx context.Context, timeout time.Duration, ready func(endpoints int) bool) (int, bool) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	t := time.NewTicker(waitInterval)
+	defer t.Stop()
+
+	for {
+		endpoints := s.collector.CurrentStats().EndpointCount
+		if ready(endpoints) {
+			return endpoints, true
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return endpoints, false
+		}
+	}
+}
+
+// waitParams returns if the request waits for the deployment (wait) and the maximum time (timeout)
+func waitParams(r *http.Request) (bool, time.Duration, error) {
+	wait := false
+	if value := r.URL.Query().Get("wait"); value != "" {
+		var err error
+		wait, err = strconv.ParseBool(value)
+		if err != nil {
+			return false, 0, fmt.Errorf("invalid wait %v", value)
+		}
+	}
+
+	timeout, err := durationParam(r, "timeout", defaultWaitTimeout)
+	return wait, timeout, err
+}
+
+// durationParam returns the duration defined in a parameter of the query or the default value
+func durationParam(r *http.Request, name string, defaultValue time.Duration) (time.Duration, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %v %v", name, value)
+	}
+
+	return d, nil
+}
+
+// Start runs the API server in address until the stop channel is closed
+func (s *Server) Start(address string, stopCh <-chan struct{}) error {
+	server := &http.Server{
+		Addr:    address,
+		Handler: s.Handler(),
+	}
+
+	go func() {
+		<-stopCh
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(ctx)
+	}()
+
+	log.Info("Starting API server", "address", address)
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
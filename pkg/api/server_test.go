@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+	"github.com/aledbf/horus-proxy/pkg/policy"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+const testToken = "secret"
+
+func TestServer(t *testing.T) {
+	collector := metrics.NewCollector(time.Minute)
+	collector.Record(&metrics.Stats{
+		Version:   metrics.StatsVersion,
+		Timestamp: float64(time.Now().Unix()),
+		Backends:  []metrics.Backend{{Name: "default-http-svc-80", Endpoints: 2}},
+	})
+
+	scenarios := []struct {
+		method string
+		path   string
+		token  string
+		// err returned requesting the demand
+		err    error
+		status int
+		// demand expected
+		demand *scaler.Demand
+	}{
+		// 0: Without token
+		{method: http.MethodPost, path: "/wake", status: http.StatusUnauthorized},
+		// 1: Wrong token
+		{method: http.MethodPost, path: "/wake", token: "other", status: http.StatusUnauthorized},
+		// 2: Not using POST
+		{method: http.MethodGet, path: "/wake", token: testToken, status: http.StatusMethodNotAllowed},
+		// 3: Invalid replicas
+		{method: http.MethodPost, path: "/wake?replicas=0", token: testToken, status: http.StatusBadRequest},
+		// 4: Invalid duration
+		{method: http.MethodPost, path: "/wake?for=soon", token: testToken, status: http.StatusBadRequest},
+		// 5: Invalid timeout
+		{method: http.MethodPost, path: "/sleep?wait=true&timeout=-1s", token: testToken, status: http.StatusBadRequest},
+		// 6: Invalid wait
+		{method: http.MethodPost, path: "/sleep?wait=maybe", token: testToken, status: http.StatusBadRequest},
+		// 7: Wake without waiting
+		{method: http.MethodPost, path: "/wake?replicas=3", token: testToken, status: http.StatusAccepted,
+			demand: &scaler.Demand{Action: policy.Wake, Replicas: 3, Source: "api"}},
+		// 8: Wake waiting for ready endpoints
+		{method: http.MethodPost, path: "/wake?replicas=2&wait=true", token: testToken, status: http.StatusOK,
+			demand: &scaler.Demand{Action: policy.Wake, Replicas: 2, Source: "api"}},
+		// 9: Sleep waiting until the timeout
+		{method: http.MethodPost, path: "/sleep?wait=true&timeout=10ms", token: testToken, status: http.StatusGatewayTimeout,
+			demand: &scaler.Demand{Action: policy.Sleep, Source: "api"}},
+		// 10: Demand rejected by an override
+		{method: http.MethodPost, path: "/sleep", token: testToken, err: &scaler.RejectedDemandError{Reason: "paused"}, status: http.StatusConflict},
+		// 11: Error requesting the demand
+		{method: http.MethodPost, path: "/sleep", token: testToken, err: fmt.Errorf("unavailable"), status: http.StatusInternalServerError},
+	}
+
+	for i, scenario := range scenarios {
+		var demand *scaler.Demand
+		server := NewServer(func(d scaler.Demand) error {
+			demand = &d
+			return scenario.err
+		}, collector, testToken)
+
+		r := httptest.NewRequest(scenario.method, scenario.path, nil)
+		if scenario.token != "" {
+			r.Header.Set("Authorization", "Bearer "+scenario.token)
+		}
+
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, r)
+
+		if w.Code != scenario.status {
+			t.Errorf("%v: expected status %v but got %v (%v)", i, scenario.status, w.Code, w.Body.String())
+			continue
+		}
+
+		if scenario.demand == nil {
+			if demand != nil && scenario.err == nil {
+				t.Errorf("%v: expected no demand but got %+v", i, demand)
+			}
+
+			continue
+		}
+
+		if demand == nil || demand.Action != scenario.demand.Action || demand.Replicas != scenario.demand.Replicas || demand.Source != scenario.demand.Source {
+			t.Errorf("%v: expected demand %+v but got %+v", i, scenario.demand, demand)
+			continue
+		}
+
+		response := &Response{}
+		err := json.Unmarshal(w.Body.Bytes(), response)
+		if err != nil {
+			t.Errorf("%v: unexpected error decoding the response: %v", i, err)
+			continue
+		}
+
+		if response.Ready != (scenario.status == http.StatusOK) || response.Endpoints != 2 {
+			t.Errorf("%v: unexpected response %+v", i, response)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	typedappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fakeClientset is a kubernetes.Interface that keeps the deployments and configmaps of
+// a namespace in memory. Other resources and operations are not implemented
+type fakeClientset struct {
+	kubernetes.Interface
+
+	deployments map[string]*appsv1.Deployment
+	configMaps  map[string]*corev1.ConfigMap
+
+	// UpdateErrors errors returned updating the deployments, by name
+	UpdateErrors map[string]error
+}
+
+func newFakeClientset(objects ...runtime.Object) *fakeClientset {
+	c := &fakeClientset{
+		deployments:  map[string]*appsv1.Deployment{},
+		configMaps:   map[string]*corev1.ConfigMap{},
+		UpdateErrors: map[string]error{},
+	}
+
+	for _, object := range objects {
+		switch o := object.(type) {
+		case *appsv1.Deployment:
+			c.deployments[o.Name] = o.DeepCopy()
+		case *corev1.ConfigMap:
+			c.configMaps[o.Name] = o.DeepCopy()
+		default:
+			panic(fmt.Sprintf("unsupported object %T", object))
+		}
+	}
+
+	return c
+}
+
+func (c *fakeClientset) AppsV1() typedappsv1.AppsV1Interface {
+	return &fakeApps{clientset: c}
+}
+
+func (c *fakeClientset) CoreV1() typedcorev1.CoreV1Interface {
+	return &fakeCore{clientset: c}
+}
+
+type fakeApps struct {
+	typedappsv1.AppsV1Interface
+	clientset *fakeClientset
+}
+
+func (a *fakeApps) Deployments(namespace string) typedappsv1.DeploymentInterface {
+	return &fakeDeployments{clientset: a.clientset}
+}
+
+type fakeDeployments struct {
+	typedappsv1.DeploymentInterface
+	clientset *fakeClientset
+}
+
+func (d *fakeDeployments) Get(name string, options metav1.GetOptions) (*appsv1.Deployment, error) {
+	deployment, ok := d.clientset.deployments[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Group: "apps", Resource: "deployments"}, name)
+	}
+
+	return deployment.DeepCopy(), nil
+}
+
+func (d *fakeDeployments) Update(deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
+	if err := d.clientset.UpdateErrors[deployment.Name]; err != nil {
+		return nil, err
+	}
+
+	if _, ok := d.clientset.deployments[deployment.Name]; !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Group: "apps", Resource: "deployments"}, deployment.Name)
+	}
+
+	d.clientset.deployments[deployment.Name] = deployment.DeepCopy()
+	return deployment.DeepCopy(), nil
+}
+
+// Patch only supports merge patches of the annotations
+func (d *fakeDeployments) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (*appsv1.Deployment, error) {
+	if pt != types.MergePatchType {
+		return nil, fmt.Errorf("unsupported patch type %v", pt)
+	}
+
+	deployment, err := d.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	patch := struct {
+		Metadata struct {
+			Annotations map[string]*string `json:"annotations"`
+		} `json:"metadata"`
+	}{}
+
+	err = json.Unmarshal(data, &patch)
+	if err != nil {
+		return nil, err
+	}
+
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+
+	for key, value := range patch.Metadata.Annotations {
+		if value == nil {
+			delete(deployment.Annotations, key)
+			continue
+		}
+
+		deployment.Annotations[key] = *value
+	}
+
+	d.clientset.deployments[name] = deployment.DeepCopy()
+	return deployment, nil
+}
+
+type fakeCore struct {
+	typedcorev1.CoreV1Interface
+	clientset *fakeClientset
+}
+
+func (c *fakeCore) ConfigMaps(namespace string) typedcorev1.ConfigMapInterface {
+	return &fakeConfigMaps{clientset: c.clientset}
+}
+
+type fakeConfigMaps struct {
+	typedcorev1.ConfigMapInterface
+	clientset *fakeClientset
+}
+
+func (c *fakeConfigMaps) Get(name string, options metav1.GetOptions) (*corev1.ConfigMap, error) {
+	cm, ok := c.clientset.configMaps[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	}
+
+	return cm.DeepCopy(), nil
+}
@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+)
+
+// Reasons of the events recorded by the proxy
+const (
+	reasonWake              = "Wake"
+	reasonSleep             = "Sleep"
+	reasonActivationTimeout = "ActivationTimeout"
+	reasonScaleFailed       = "ScaleFailed"
+	reasonReloadFailed      = "ReloadFailed"
+)
+
+// eventRecorder records events in the service handled by the proxy and the target deployment
+type eventRecorder struct {
+	recorder record.EventRecorder
+	service  *corev1.Service
+}
+
+// event records the same event in the service and the deployment (if available)
+func (e *eventRecorder) event(deployment *appsv1.Deployment, eventType, reason, messageFmt string, args ...interface{}) {
+	if e == nil || e.recorder == nil {
+		return
+	}
+
+	message := fmt.Sprintf(messageFmt, args...)
+
+	if e.service != nil {
+		e.recorder.Event(e.service, eventType, reason, message)
+	}
+
+	if deployment != nil {
+		e.recorder.Event(deployment, eventType, reason, message)
+	}
+}
+
+// describeStats returns a human readable version of the stats that triggered a scaling decision
+func describeStats(stats *metrics.Proxy) string {
+	return fmt.Sprintf("waiting for pods: %v, seconds since last request: %v, pending requests: %v, endpoints: %v",
+		stats.WaitingForPods, stats.LastRequest, stats.PendingRequests, stats.EndpointCount)
+}
@@ -0,0 +1,271 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+// awakeDependentsAnnotation annotation of a deployment with the deployments
+// (namespace/name, comma separated) that woke it and are still awake
+const awakeDependentsAnnotation = "horus-proxy/awake-dependents"
+
+// member is a deployment of the wake group of the deployment of the proxy
+type member struct {
+	// Name of the deployment
+	Name string
+	// Replicas minimum number of replicas when the group is woken
+	Replicas int32
+}
+
+// parseMembers returns the members of the wake group, in activation order,
+// defined as name or name:replicas
+func parseMembers(dependencies []string) ([]member, error) {
+	members := make([]member, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		m := member{Name: dependency, Replicas: 1}
+
+		if i := strings.LastIndex(dependency, ":"); i != -1 {
+			replicas, err := strconv.ParseInt(dependency[i+1:], 10, 32)
+			if err != nil || replicas < 1 {
+				return nil, fmt.Errorf("invalid replicas of dependency %v", dependency)
+			}
+
+			m.Name = dependency[:i]
+			m.Replicas = int32(replicas)
+		}
+
+		if m.Name == "" {
+			return nil, fmt.Errorf("invalid dependency %v", dependency)
+		}
+
+		members = append(members, m)
+	}
+
+	return members, nil
+}
+
+// wakeGroup scales up the members of the group in order. Every member must be
+// ready before the next one is woken. If a member is not woken the deployment
+// is removed from the dependents of the members, to not keep them awake
+func wakeGroup(config *env.Spec, client kubernetes.Interface, members []member) error {
+	for i, m := range members {
+		err := wakeMember(config, client, m)
+		if err != nil {
+			for _, woken := range members[:i+1] {
+				_, rerr := setAwakeDependent(config.Namespace, woken.Name, target(config), false, client)
+				if rerr != nil {
+					log.Error(rerr, "removing the deployment from the dependents", "deployment", woken.Name)
+				}
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// wakeMember records the deployment as dependent of a member of the group and
+// scales it up, waiting until it is ready
+func wakeMember(config *env.Spec, client kubernetes.Interface, m member) error {
+	_, err := setAwakeDependent(config.Namespace, m.Name, target(config), true, client)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Waking dependency", "deployment", m.Name, "replicas", m.Replicas)
+	_, err = scaleDeployment(config.Namespace, m.Name, m.Replicas, config.ActivationTimeout, client)
+	if err != nil {
+		return fmt.Errorf("waking dependency %v: %v", m.Name, err)
+	}
+
+	// the dependency could be scaling up, i.e. woken by another group
+	err = waitForReplicas(config.Namespace, m.Name, m.Replicas, config.ActivationTimeout, client)
+	if err != nil {
+		return fmt.Errorf("waiting for dependency %v: %v", m.Name, err)
+	}
+
+	return nil
+}
+
+// sleepGroup scales to zero the members of the group, in reverse order, that
+// are idle and not required by other awake deployments
+func sleepGroup(config *env.Spec, client kubernetes.Interface, members []member) error {
+	for i := len(members) - 1; i >= 0; i-- {
+		m := members[i]
+
+		dependents, err := setAwakeDependent(config.Namespace, m.Name, target(config), false, client)
+		if err != nil {
+			return err
+		}
+
+		if len(dependents) > 0 {
+			log.Info("Dependency is required by other deployments", "deployment", m.Name, "dependents", dependents)
+			continue
+		}
+
+		busy, err := busyMember(config, client, m.Name, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if busy != "" {
+			// the proxy of the dependency scales it to zero once it is idle
+			log.Info("Dependency is not idle", "deployment", m.Name, "proxies", busy)
+			continue
+		}
+
+		log.Info("Scaling dependency to zero", "deployment", m.Name)
+		_, err = scaleDeployment(config.Namespace, m.Name, 0, config.ActivationTimeout, client)
+		if err != nil {
+			return fmt.Errorf("scaling dependency %v to zero: %v", m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// busyGroup returns the first member of the group that is not idle and the replicas of its
+// proxy processing requests. The group sleeps together only when all the members are idle.
+// Members required by other awake deployments do not sleep with the group and are not checked
+func busyGroup(config *env.Spec, client kubernetes.Interface, members []member) (string, string, error) {
+	for _, m := range members {
+		deployment, err := client.AppsV1().Deployments(config.Namespace).Get(m.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", "", err
+		}
+
+		if hasOtherDependents(deployment, target(config)) {
+			continue
+		}
+
+		busy, err := busyMember(config, client, m.Name, time.Now())
+		if err != nil {
+			return "", "", err
+		}
+
+		if busy != "" {
+			return m.Name, busy, nil
+		}
+	}
+
+	return "", "", nil
+}
+
+// busyMember returns the replicas of the proxy of a member of the group processing requests,
+// using the activity they share in the configmap <member>-proxy-activity. Members without a proxy
+// only receive requests through the group and are idle when the deployment of the proxy is idle
+func busyMember(config *env.Spec, client kubernetes.Interface, name string, now time.Time) (string, error) {
+	cm, err := client.CoreV1().ConfigMaps(config.Namespace).Get(name+"-proxy-activity", metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	// the proxies of the members are expected to use the same heartbeat
+	stale := peerStaleHeartbeats * config.PeerHeartbeat
+	if stale == 0 {
+		stale = peerExpiration
+	}
+
+	var busy []string
+	for _, value := range cm.Data {
+		peer := scaler.Peer{}
+		err := json.Unmarshal([]byte(value), &peer)
+		if err != nil || now.Sub(peer.Time) > stale {
+			continue
+		}
+
+		if peer.Busy() {
+			busy = append(busy, peer.Name)
+		}
+	}
+
+	sort.Strings(busy)
+
+	return strings.Join(busy, ", "), nil
+}
+
+// awakeDependents returns the deployments that require the deployment awake
+func awakeDependents(deployment *appsv1.Deployment) []string {
+	value := deployment.Annotations[awakeDependentsAnnotation]
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+// hasOtherDependents returns true if deployments other than the dependent require the deployment awake
+func hasOtherDependents(deployment *appsv1.Deployment, dependent string) bool {
+	for _, d := range awakeDependents(deployment) {
+		if d != dependent {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setAwakeDependent adds (awake) or removes a dependent deployment from the
+// annotation of a deployment. Returns the other dependents of the deployment
+func setAwakeDependent(namespace, name, dependent string, awake bool, client kubernetes.Interface) ([]string, error) {
+	var others []string
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := client.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		current := awakeDependents(deployment)
+
+		others = nil
+		for _, d := range current {
+			if d != dependent {
+				others = append(others, d)
+			}
+		}
+
+		dependents := others
+		if awake {
+			dependents = append(append([]string{}, others...), dependent)
+		}
+
+		sort.Strings(dependents)
+		if strings.Join(dependents, ",") == strings.Join(current, ",") {
+			return nil
+		}
+
+		if deployment.Annotations == nil {
+			deployment.Annotations = map[string]string{}
+		}
+
+		if len(dependents) == 0 {
+			delete(deployment.Annotations, awakeDependentsAnnotation)
+		} else {
+			deployment.Annotations[awakeDependentsAnnotation] = strings.Join(dependents, ",")
+		}
+
+		_, err = client.AppsV1().Deployments(namespace).Update(deployment)
+		return err
+	})
+
+	return others, err
+}
@@ -0,0 +1,232 @@
+package proxy
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+func TestParseMembers(t *testing.T) {
+	scenarios := []struct {
+		dependencies []string
+		members      []member
+		err          bool
+	}{
+		// 0: Without dependencies
+		{members: []member{}},
+		// 1: Names and replicas
+		{dependencies: []string{"redis", "api:2"}, members: []member{{Name: "redis", Replicas: 1}, {Name: "api", Replicas: 2}}},
+		// 2: Invalid replicas
+		{dependencies: []string{"api:0"}, err: true},
+		// 3: Invalid number
+		{dependencies: []string{"api:two"}, err: true},
+		// 4: Without name
+		{dependencies: []string{":2"}, err: true},
+	}
+
+	for i, scenario := range scenarios {
+		members, err := parseMembers(scenario.dependencies)
+		if scenario.err {
+			if err == nil {
+				t.Errorf("%v: expected an error", i)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(members, scenario.members) {
+			t.Errorf("%v: expected %v but got %v", i, scenario.members, members)
+		}
+	}
+}
+
+func TestSetAwakeDependent(t *testing.T) {
+	client := newFakeClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "default"},
+	})
+
+	steps := []struct {
+		dependent  string
+		awake      bool
+		others     []string
+		annotation string
+	}{
+		// 0: First dependent
+		{dependent: "default/app", awake: true, annotation: "default/app"},
+		// 1: Second dependent
+		{dependent: "default/admin", awake: true, others: []string{"default/app"}, annotation: "default/admin,default/app"},
+		// 2: A dependent woken again is recorded once
+		{dependent: "default/app", awake: true, others: []string{"default/admin"}, annotation: "default/admin,default/app"},
+		// 3: A dependent sleeps
+		{dependent: "default/admin", others: []string{"default/app"}, annotation: "default/app"},
+		// 4: The last dependent sleeps
+		{dependent: "default/app", annotation: ""},
+	}
+
+	for i, step := range steps {
+		others, err := setAwakeDependent("default", "redis", step.dependent, step.awake, client)
+		if err != nil {
+			t.Fatalf("%v: unexpected error %v", i, err)
+		}
+
+		if !reflect.DeepEqual(others, step.others) {
+			t.Errorf("%v: expected other dependents %v but got %v", i, step.others, others)
+		}
+
+		deployment, err := client.AppsV1().Deployments("default").Get("redis", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%v: unexpected error %v", i, err)
+		}
+
+		if annotation := deployment.Annotations[awakeDependentsAnnotation]; annotation != step.annotation {
+			t.Errorf("%v: expected annotation %q but got %q", i, step.annotation, annotation)
+		}
+	}
+}
+
+func TestBusyMember(t *testing.T) {
+	now := time.Now()
+	config := &env.Spec{Namespace: "default", PeerHeartbeat: 10 * time.Second}
+
+	activity := func(peers ...scaler.Peer) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-proxy-activity", Namespace: "default"},
+			Data:       map[string]string{},
+		}
+
+		for _, peer := range peers {
+			data, _ := json.Marshal(peer)
+			cm.Data[peer.Name] = string(data)
+		}
+
+		return cm
+	}
+
+	scenarios := []struct {
+		client *fakeClientset
+		busy   string
+	}{
+		// 0: Without proxy
+		{client: newFakeClientset(), busy: ""},
+		// 1: Idle proxy
+		{client: newFakeClientset(activity(scaler.Peer{Name: "api-proxy-a", Time: now, Idle: true})), busy: ""},
+		// 2: Proxy processing requests
+		{client: newFakeClientset(activity(
+			scaler.Peer{Name: "api-proxy-a", Time: now, Idle: true},
+			scaler.Peer{Name: "api-proxy-b", Time: now, Idle: true, ActiveRequests: 2},
+		)), busy: "api-proxy-b"},
+		// 3: Replica of the proxy without recent heartbeats
+		{client: newFakeClientset(activity(scaler.Peer{Name: "api-proxy-a", Time: now.Add(-time.Minute)})), busy: ""},
+	}
+
+	for i, scenario := range scenarios {
+		busy, err := busyMember(config, scenario.client, "api", now)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", i, err)
+			continue
+		}
+
+		if busy != scenario.busy {
+			t.Errorf("%v: expected busy proxies %q but got %q", i, scenario.busy, busy)
+		}
+	}
+}
+
+func TestDeploymentScalerSleep(t *testing.T) {
+	now := time.Now()
+	config := &env.Spec{Namespace: "default", Deployment: "app", PeerHeartbeat: 10 * time.Second, ActivationTimeout: time.Second}
+
+	deployment := func(name string, replicas int32, dependents string) *appsv1.Deployment {
+		d := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: map[string]string{}},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		}
+
+		if dependents != "" {
+			d.Annotations[awakeDependentsAnnotation] = dependents
+		}
+
+		return d
+	}
+
+	busyRedis := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis-proxy-activity", Namespace: "default"},
+		Data:       map[string]string{},
+	}
+	data, _ := json.Marshal(scaler.Peer{Name: "redis-proxy-a", Time: now, Idle: true, ActiveRequests: 1})
+	busyRedis.Data["redis-proxy-a"] = string(data)
+
+	scenarios := []struct {
+		client *fakeClientset
+		// replicas expected after the scale operation
+		app   int32
+		redis int32
+	}{
+		// 0: Idle dependency
+		{client: newFakeClientset(deployment("app", 1, ""), deployment("redis", 1, "default/app")), app: 0, redis: 0},
+		// 1: Busy dependency
+		{client: newFakeClientset(deployment("app", 1, ""), deployment("redis", 1, "default/app"), busyRedis), app: 1, redis: 1},
+		// 2: Busy dependency required by another awake deployment
+		{client: newFakeClientset(deployment("app", 1, ""), deployment("redis", 1, "default/admin,default/app"), busyRedis), app: 0, redis: 1},
+	}
+
+	for i, scenario := range scenarios {
+		s := &deploymentScaler{config: config, client: scenario.client, members: []member{{Name: "redis", Replicas: 1}}}
+
+		_, err := s.Scale(0)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", i, err)
+			continue
+		}
+
+		for name, expected := range map[string]int32{"app": scenario.app, "redis": scenario.redis} {
+			d, _ := scenario.client.AppsV1().Deployments("default").Get(name, metav1.GetOptions{})
+			if *d.Spec.Replicas != expected {
+				t.Errorf("%v: expected %v replicas of %v but got %v", i, expected, name, *d.Spec.Replicas)
+			}
+		}
+	}
+}
+
+func TestWakeGroupFailure(t *testing.T) {
+	config := &env.Spec{Namespace: "default", Deployment: "app", ActivationTimeout: 10 * time.Millisecond}
+
+	replicas := int32(0)
+	redis := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+	}
+	// the replicas of the api are never ready
+	api := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+
+	client := newFakeClientset(redis, api)
+
+	err := wakeGroup(config, client, []member{{Name: "redis", Replicas: 1}, {Name: "api", Replicas: 1}})
+	if err == nil {
+		t.Fatalf("expected an error waking the api")
+	}
+
+	for _, name := range []string{"redis", "api"} {
+		deployment, _ := client.AppsV1().Deployments("default").Get(name, metav1.GetOptions{})
+		if dependents := awakeDependents(deployment); len(dependents) != 0 {
+			t.Errorf("expected no awake dependents of %v but got %v", name, dependents)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package proxy
 import (
 	"fmt"
 
+	"github.com/aledbf/horus-proxy/pkg/env"
 	"github.com/aledbf/horus-proxy/pkg/nginx"
 	corev1 "k8s.io/api/core/v1"
 )
@@ -15,6 +16,8 @@ const (
 func kubeToNGINX(svc *corev1.Service, pods []*corev1.Pod) (*nginx.Configuration, error) {
 	servers := make([]nginx.Server, 0)
 
+	affinity := sessionAffinity(svc)
+
 	for _, service := range svc.Spec.Ports {
 		upstreams := []nginx.Endpoint{}
 
@@ -45,9 +48,10 @@ func kubeToNGINX(svc *corev1.Service, pods []*corev1.Pod) (*nginx.Configuration,
 		}
 
 		servers = append(servers, nginx.Server{
-			Name:      fmt.Sprintf("%v-%v-%v", svc.Namespace, svc.Name, service.TargetPort.String()),
-			Port:      service.TargetPort.String(),
-			Endpoints: upstreams,
+			Name:            fmt.Sprintf("%v-%v-%v", svc.Namespace, svc.Name, service.TargetPort.String()),
+			Port:            service.TargetPort.String(),
+			SessionAffinity: affinity,
+			Endpoints:       upstreams,
 		})
 	}
 
@@ -55,3 +59,54 @@ func kubeToNGINX(svc *corev1.Service, pods []*corev1.Pod) (*nginx.Configuration,
 		Servers: servers,
 	}, nil
 }
+
+// sessionAffinity extracts the session affinity configuration of the service.
+// The default timeout is the same used by kube-proxy (three hours)
+func sessionAffinity(svc *corev1.Service) nginx.SessionAffinity {
+	if svc.Spec.SessionAffinity != corev1.ServiceAffinityClientIP {
+		return nginx.SessionAffinity{}
+	}
+
+	timeout := corev1.DefaultClientIPServiceAffinitySeconds
+	if cfg := svc.Spec.SessionAffinityConfig; cfg != nil && cfg.ClientIP != nil && cfg.ClientIP.TimeoutSeconds != nil {
+		timeout = *cfg.ClientIP.TimeoutSeconds
+	}
+
+	return nginx.SessionAffinity{
+		Type:           string(corev1.ServiceAffinityClientIP),
+		TimeoutSeconds: timeout,
+	}
+}
+
+// generalConfiguration returns the settings of the proxy defined in the environment
+func generalConfiguration(config *env.Spec) nginx.General {
+	return nginx.General{
+		OutlierDetection: nginx.OutlierDetection{
+			ConsecutiveFailures: config.OutlierConsecutiveFailures,
+			EjectionSeconds:     int(config.OutlierEjectionTime.Seconds()),
+			MaxEjectionPercent:  config.OutlierMaxEjectionPercent,
+			Retries:             config.UpstreamRetries,
+		},
+		SlowStart: nginx.SlowStart{
+			WindowSeconds:     int(config.SlowStartWindow.Seconds()),
+			MinReadyEndpoints: config.MinReadyEndpoints,
+			ReleaseRate:       config.ReleaseRate,
+		},
+		Forwarded: nginx.Forwarded{
+			Enabled:          config.ForwardedHeaders,
+			TrustedCIDRs:     config.TrustedCIDRs,
+			UseProxyProtocol: config.UseProxyProtocol,
+		},
+		Tracing: nginx.Tracing{
+			Enabled:     config.OTLPEndpoint != "",
+			SampleRatio: config.TracingSampleRatio,
+		},
+		Background: nginx.Background{
+			Paths:      config.BackgroundPaths,
+			UserAgents: config.BackgroundUserAgents,
+			CIDRs:      config.BackgroundCIDRs,
+			Headers:    config.BackgroundHeaders,
+			Wake:       config.BackgroundWake,
+		},
+	}
+}
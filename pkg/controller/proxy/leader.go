@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+// leaderElection elects the replica of the proxy that takes the scaling decisions.
+// The data plane runs in every replica
+type leaderElection struct {
+	config *env.Spec
+	client kubernetes.Interface
+
+	// name of the replica
+	identity string
+
+	mu      sync.RWMutex
+	leading bool
+}
+
+// newLeaderElection returns the leader election of the replica with the name identity.
+// Without leader election enabled the replica is always the leader
+func newLeaderElection(config *env.Spec, client kubernetes.Interface, identity string) *leaderElection {
+	l := &leaderElection{
+		config:   config,
+		client:   client,
+		identity: identity,
+	}
+
+	l.setLeading(!config.LeaderElection)
+
+	return l
+}
+
+// isLeader returns true if the replica takes the scaling decisions
+func (l *leaderElection) isLeader() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.leading
+}
+
+// run campaigns to be the leader until the channel is closed
+func (l *leaderElection) run(stopCh <-chan struct{}) error {
+	lock, err := resourcelock.New(resourcelock.ConfigMapsResourceLock, l.config.Namespace, l.config.LeaderElectionID,
+		l.client.CoreV1(), l.client.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: l.identity})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	leaseDuration := l.config.LeaderElectionLeaseDuration
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: leaseDuration,
+		RenewDeadline: leaseDuration * 2 / 3,
+		RetryPeriod:   leaseDuration / 5,
+		// the lock is released on shutdown for a fast failover
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Info("Started leading, taking the scaling decisions", "identity", l.identity)
+				l.setLeading(true)
+			},
+			OnStoppedLeading: func() {
+				log.Info("Stopped leading", "identity", l.identity)
+				l.setLeading(false)
+			},
+			OnNewLeader: func(identity string) {
+				log.Info("New leader elected", "leader", identity, "identity", l.identity)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Run returns when the replica stops leading. Campaign again until the channel is closed
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+
+	return nil
+}
+
+func (l *leaderElection) setLeading(leading bool) {
+	l.mu.Lock()
+	l.leading = leading
+	l.mu.Unlock()
+
+	value := 0.0
+	if leading {
+		value = 1
+	}
+
+	leader.WithLabelValues(target(l.config)).Set(value)
+}
+
+// demand requests to wake or sleep the deployment. The leader applies the demand in
+// the engine, other replicas use the annotation of the deployment read by the leader
+func (l *leaderElection) demand(engine *scaler.Engine) func(scaler.Demand) error {
+	return func(d scaler.Demand) error {
+		if l.isLeader() {
+			return engine.Demand(d)
+		}
+
+		deployment, err := l.client.AppsV1().Deployments(l.config.Namespace).Get(l.config.Deployment, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		override, err := scaler.ParseOverride(deployment.Annotations)
+		if err != nil {
+			return err
+		}
+
+		err = override.Rejects(d, time.Now())
+		if err != nil {
+			return err
+		}
+
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{
+					scaler.DemandAnnotation: d.Annotation(time.Now()),
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = l.client.AppsV1().Deployments(l.config.Namespace).Patch(l.config.Deployment, types.MergePatchType, patch)
+		return err
+	}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+	"github.com/aledbf/horus-proxy/pkg/policy"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+func TestLeaderElectionDemand(t *testing.T) {
+	config := &env.Spec{Namespace: "default", Deployment: "app", LeaderElection: true}
+	client := newFakeClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+	})
+
+	clock := scaler.NewFakeClock(time.Now())
+	scaleClient := scaler.NewFakeClient(clock, 0, 0)
+	engine := scaler.NewEngine(&policy.LastRequest{IdleAfter: time.Minute}, metrics.NewCollector(time.Minute), scaleClient, clock, "default", "app")
+
+	// replicas that are not the leader write the demand in the annotation
+	elector := newLeaderElection(config, client, "app-proxy-b")
+
+	err := elector.demand(engine)(scaler.Demand{Action: policy.Wake, Replicas: 2, Until: time.Now().Add(time.Hour), Source: "api"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	deployment, _ := client.AppsV1().Deployments("default").Get("app", metav1.GetOptions{})
+	if _, ok := deployment.Annotations[scaler.DemandAnnotation]; !ok {
+		t.Fatalf("expected the demand in the annotations but got %v", deployment.Annotations)
+	}
+
+	if r := engine.Step(); r.Scaled() {
+		t.Errorf("expected no demand applied by a replica that is not the leader but got %+v", r)
+	}
+
+	// the leader consumes the annotation
+	err = applyAnnotations(config, client, engine)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	deployment, _ = client.AppsV1().Deployments("default").Get("app", metav1.GetOptions{})
+	if _, ok := deployment.Annotations[scaler.DemandAnnotation]; ok {
+		t.Errorf("expected the demand removed from the annotations but got %v", deployment.Annotations)
+	}
+
+	if r := engine.Step(); !r.Scaled() || r.Replicas != 2 {
+		t.Errorf("expected a scale up to 2 replicas due the demand but got %+v", r)
+	}
+
+	// demands rejected by an override are not written
+	deployment.Annotations[scaler.PausedAnnotation] = "true"
+	_, err = client.AppsV1().Deployments("default").Update(deployment)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	err = elector.demand(engine)(scaler.Demand{Action: policy.Sleep, Source: "api"})
+	if _, ok := err.(*scaler.RejectedDemandError); !ok {
+		t.Errorf("expected a rejected demand but got %v", err)
+	}
+
+	deployment, _ = client.AppsV1().Deployments("default").Get("app", metav1.GetOptions{})
+	if _, ok := deployment.Annotations[scaler.DemandAnnotation]; ok {
+		t.Errorf("expected no demand in the annotations but got %v", deployment.Annotations)
+	}
+
+	// the leader applies the demands in the engine
+	elector.setLeading(true)
+	delete(deployment.Annotations, scaler.PausedAnnotation)
+	_, err = client.AppsV1().Deployments("default").Update(deployment)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	err = applyAnnotations(config, client, engine)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	err = elector.demand(engine)(scaler.Demand{Action: policy.Wake, Replicas: 3, Until: time.Now().Add(time.Hour), Source: "api"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	deployment, _ = client.AppsV1().Deployments("default").Get("app", metav1.GetOptions{})
+	if _, ok := deployment.Annotations[scaler.DemandAnnotation]; ok {
+		t.Errorf("expected no demand in the annotations of the leader but got %v", deployment.Annotations)
+	}
+
+	if r := engine.Step(); !r.Scaled() || r.Replicas != 3 {
+		t.Errorf("expected a scale up to 3 replicas due the demand but got %+v", r)
+	}
+}
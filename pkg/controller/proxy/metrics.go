@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+)
+
+var (
+	scaleOperations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "horus_scale_operations_total",
+			Help: "Number of scale operations by target, direction and result",
+		},
+		[]string{"target", "direction", "result"},
+	)
+
+	scaleDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "horus_scale_duration_seconds",
+			Help:    "Time from the scale request until the target reached the desired ready replicas",
+			Buckets: []float64{1, 2.5, 5, 10, 20, 30, 60, 90, 120, 180, 300},
+		},
+		[]string{"target", "direction"},
+	)
+
+	coldStartDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "horus_cold_start_duration_seconds",
+			Help:    "Time from the first held request until the first ready endpoint of the target",
+			Buckets: []float64{1, 2.5, 5, 10, 20, 30, 60, 90, 120, 180, 300},
+		},
+		[]string{"target"},
+	)
+
+	heldRequestWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "horus_held_request_wait_seconds",
+			Help:    "Time requests were held by the proxy until they were released to the target",
+			Buckets: []float64{1, 2.5, 5, 10, 20, 30, 60, 90, 120, 180, 300},
+		},
+		[]string{"target"},
+	)
+
+	avoidedColdStarts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "horus_avoided_cold_starts_total",
+			Help: "Number of times the target was woken from zero by a policy and processed the first requests without holding them",
+		},
+		[]string{"target"},
+	)
+
+	wakeups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "horus_wakeups_total",
+			Help: "Number of times the target was scaled up by target, policy and attribute of the request that woke it",
+		},
+		[]string{"target", "policy", "trigger"},
+	)
+
+	flappingTargets = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "horus_flapping",
+			Help: "Indicates if the target woke too many times in the last hour and must be idle longer to sleep",
+		},
+		[]string{"target"},
+	)
+
+	leader = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "horus_leader",
+			Help: "Indicates if the replica of the proxy takes the scaling decisions of the target",
+		},
+		[]string{"target"},
+	)
+
+	reconcileErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "horus_reconcile_errors_total",
+			Help: "Number of errors reconciling the NGINX configuration of the target",
+		},
+		[]string{"target"},
+	)
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		scaleOperations,
+		scaleDuration,
+		coldStartDuration,
+		heldRequestWait,
+		wakeups,
+		avoidedColdStarts,
+		flappingTargets,
+		leader,
+		reconcileErrors,
+	)
+}
+
+// result returns the value of the result label for the error
+func result(err error) string {
+	if err != nil {
+		return resultError
+	}
+
+	return resultSuccess
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"encoding/json"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+// applyAnnotations sets the override of the decisions of the policies defined in the
+// annotations of the deployment and the demand to wake or sleep it. The previous
+// override is kept if the annotations are not valid
+func applyAnnotations(config *env.Spec, client kubernetes.Interface, engine *scaler.Engine) error {
+	deployment, err := client.AppsV1().Deployments(config.Namespace).Get(config.Deployment, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	override, err := scaler.ParseOverride(deployment.Annotations)
+	if err != nil {
+		return err
+	}
+
+	engine.SetOverride(override)
+
+	value, ok := deployment.Annotations[scaler.DemandAnnotation]
+	if !ok {
+		return nil
+	}
+
+	// the demand is applied only once
+	err = removeDemandAnnotation(config, client)
+	if err != nil {
+		return err
+	}
+
+	demand, err := scaler.ParseDemand(value, time.Now())
+	if err != nil {
+		return err
+	}
+
+	log.Info("Demand requested using the annotation", "action", demand.Action)
+	return engine.Demand(*demand)
+}
+
+// removeDemandAnnotation removes the demand to wake or sleep from the annotations of the deployment
+func removeDemandAnnotation(config *env.Spec, client kubernetes.Interface) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				scaler.DemandAnnotation: nil,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = client.AppsV1().Deployments(config.Namespace).Patch(config.Deployment, types.MergePatchType, patch)
+	return err
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+	"github.com/aledbf/horus-proxy/pkg/policy"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+const (
+	// peerStaleHeartbeats number of missed heartbeats before a replica is ignored
+	peerStaleHeartbeats = 3
+
+	// peerExpiration time after the last heartbeat a replica is removed from the configmap
+	peerExpiration = 10 * time.Minute
+)
+
+// peerStore shares the activity of the replicas of the proxy of the deployment
+// using a configmap with a key for each replica
+type peerStore struct {
+	config    *env.Spec
+	client    kubernetes.Interface
+	collector *metrics.Collector
+
+	// name of the replica
+	identity string
+
+	mu    sync.RWMutex
+	self  scaler.Peer
+	peers []scaler.Peer
+
+	// requests processed by the other replicas in the previous heartbeat
+	requests map[string]int64
+}
+
+// newPeerStore returns a store for the replica with the name identity. The requests
+// processed by the other replicas are added to the histogram of the requests of the collector
+func newPeerStore(config *env.Spec, client kubernetes.Interface, collector *metrics.Collector, identity string) *peerStore {
+	return &peerStore{
+		config:    config,
+		client:    client,
+		collector: collector,
+		identity:  identity,
+		self: scaler.Peer{
+			Name: identity,
+			Idle: true,
+		},
+	}
+}
+
+// Peers returns the other replicas with a recent heartbeat
+func (s *peerStore) Peers() []scaler.Peer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cutoff := time.Now().Add(-peerStaleHeartbeats * s.config.PeerHeartbeat)
+
+	var peers []scaler.Peer
+	for _, peer := range s.peers {
+		if peer.Time.After(cutoff) {
+			peers = append(peers, peer)
+		}
+	}
+
+	return peers
+}
+
+// record updates the activity of the replica with the result of a step of the engine
+func (s *peerStore) record(r *scaler.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.self.Idle = r.Decision.Action == policy.Sleep
+	s.self.HeldRequests = r.Stats.HeldRequests
+	s.self.ActiveRequests = r.Stats.PendingRequests - r.Stats.HeldRequests
+}
+
+// heartbeat publishes the activity of the replica and reads the activity of the other replicas
+func (s *peerStore) heartbeat() error {
+	now := time.Now()
+
+	s.mu.RLock()
+	self := s.self
+	s.mu.RUnlock()
+
+	self.Time = now
+	self.Requests = s.collector.Requests()
+
+	data, err := json.Marshal(self)
+	if err != nil {
+		return err
+	}
+
+	configMaps := s.client.CoreV1().ConfigMaps(s.config.Namespace)
+
+	var peers []scaler.Peer
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(s.config.PeersConfigMap, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			peers = nil
+			_, err = configMaps.Create(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.config.PeersConfigMap,
+					Namespace: s.config.Namespace,
+				},
+				Data: map[string]string{
+					s.identity: string(data),
+				},
+			})
+
+			return err
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+
+		peers = nil
+		for name, value := range cm.Data {
+			if name == s.identity {
+				continue
+			}
+
+			peer := scaler.Peer{}
+			err := json.Unmarshal([]byte(value), &peer)
+			if err != nil || now.Sub(peer.Time) > peerExpiration {
+				// the replica does not exist anymore
+				delete(cm.Data, name)
+				continue
+			}
+
+			peers = append(peers, peer)
+		}
+
+		cm.Data[s.identity] = string(data)
+
+		_, err = configMaps.Update(cm)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.peers = peers
+	s.mu.Unlock()
+
+	s.collector.AddRequests(now, s.peerRequests(peers))
+
+	return nil
+}
+
+// peerRequests returns the requests processed by the other replicas since the previous heartbeat
+func (s *peerStore) peerRequests(peers []scaler.Peer) int64 {
+	var total int64
+
+	requests := make(map[string]int64, len(peers))
+	for _, peer := range peers {
+		requests[peer.Name] = peer.Requests
+
+		previous, ok := s.requests[peer.Name]
+		switch {
+		case !ok:
+			// the requests of a new replica before its first heartbeat are unknown
+		case peer.Requests < previous:
+			// counters are reset when NGINX restarts
+			total += peer.Requests
+		default:
+			total += peer.Requests - previous
+		}
+	}
+
+	s.requests = requests
+
+	return total
+}
+
+// run publishes the activity of the replica periodically until the channel is closed
+func (s *peerStore) run(stopCh <-chan struct{}) {
+	for t := time.NewTicker(s.config.PeerHeartbeat); ; {
+		select {
+		case <-t.C:
+			err := s.heartbeat()
+			if err != nil {
+				log.Error(err, "sharing the activity of the proxy", "configmap", s.config.PeersConfigMap)
+			}
+		case <-stopCh:
+			t.Stop()
+			return
+		}
+	}
+}
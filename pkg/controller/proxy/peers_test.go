@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+func TestPeerRequests(t *testing.T) {
+	s := &peerStore{}
+
+	steps := []struct {
+		peers    []scaler.Peer
+		requests int64
+	}{
+		// 0: The requests of the replicas before the first heartbeat are unknown
+		{peers: []scaler.Peer{{Name: "a", Requests: 100}}, requests: 0},
+		// 1: Requests since the previous heartbeat and a new replica
+		{peers: []scaler.Peer{{Name: "a", Requests: 130}, {Name: "b", Requests: 10}}, requests: 30},
+		// 2: NGINX restarted in a replica
+		{peers: []scaler.Peer{{Name: "a", Requests: 5}, {Name: "b", Requests: 12}}, requests: 7},
+		// 3: A replica was removed
+		{peers: []scaler.Peer{{Name: "b", Requests: 20}}, requests: 8},
+	}
+
+	for i, step := range steps {
+		requests := s.peerRequests(step.peers)
+		if requests != step.requests {
+			t.Errorf("%v: expected %v requests but got %v", i, step.requests, requests)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"encoding/json"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+)
+
+const (
+	// profileKey key of the configmap with the histogram of the requests
+	profileKey = "profile.json"
+
+	// profileSaveInterval time between updates of the persisted histogram
+	profileSaveInterval = 10 * time.Minute
+)
+
+// loadProfile returns the histogram of the requests persisted in the
+// configmap. Returns nil if the configmap does not exist
+func loadProfile(config *env.Spec, client kubernetes.Interface) (*metrics.Profile, error) {
+	cm, err := client.CoreV1().ConfigMaps(config.Namespace).Get(config.ProfileConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &metrics.Profile{}
+	err = json.Unmarshal([]byte(cm.Data[profileKey]), profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// saveProfile persists the histogram of the requests in the configmap
+func saveProfile(config *env.Spec, client kubernetes.Interface, profile *metrics.Profile) error {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+
+	configMaps := client.CoreV1().ConfigMaps(config.Namespace)
+
+	cm, err := configMaps.Get(config.ProfileConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      config.ProfileConfigMap,
+				Namespace: config.Namespace,
+			},
+			Data: map[string]string{
+				profileKey: string(data),
+			},
+		})
+
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+
+	cm.Data[profileKey] = string(data)
+
+	_, err = configMaps.Update(cm)
+	return err
+}
+
+// persistProfile periodically persists the histogram of the requests of the
+// collector in the configmap and, for the last time, when the channel is closed.
+// Only the leader persists the histogram, which includes the requests of the other replicas
+func persistProfile(config *env.Spec, client kubernetes.Interface, collector *metrics.Collector, elector *leaderElection, stopCh <-chan struct{}) {
+	for t := time.NewTicker(profileSaveInterval); ; {
+		select {
+		case <-t.C:
+			if !elector.isLeader() {
+				continue
+			}
+
+			err := saveProfile(config, client, collector.Profile())
+			if err != nil {
+				log.Error(err, "persisting traffic profile", "configmap", config.ProfileConfigMap)
+			}
+		case <-stopCh:
+			t.Stop()
+
+			if !elector.isLeader() {
+				return
+			}
+
+			err := saveProfile(config, client, collector.Profile())
+			if err != nil {
+				log.Error(err, "persisting traffic profile", "configmap", config.ProfileConfigMap)
+			}
+
+			return
+		}
+	}
+}
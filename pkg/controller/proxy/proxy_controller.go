@@ -17,8 +17,10 @@ package proxy
 
 import (
 	"fmt"
+	"os"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -27,24 +29,35 @@ import (
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
 
 	//apiscore "k8s.io/kubernetes/pkg/apis/core"
 	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	"github.com/aledbf/horus-proxy/pkg/api"
+	"github.com/aledbf/horus-proxy/pkg/debug"
 	"github.com/aledbf/horus-proxy/pkg/env"
 	"github.com/aledbf/horus-proxy/pkg/metrics"
 	"github.com/aledbf/horus-proxy/pkg/nginx"
+	"github.com/aledbf/horus-proxy/pkg/policy"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+	"github.com/aledbf/horus-proxy/pkg/tracing"
 )
 
 var log = logf.Log.WithName("controller")
 
+const eventSource = "horus-proxy"
+
 // Add creates a new Traffic Controller and adds it to the Manager with default RBAC. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
@@ -54,7 +67,8 @@ func Add(mgr manager.Manager) error {
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
 	return &ReconcileTraffic{
-		Client: mgr.GetClient(),
+		Client:   mgr.GetClient(),
+		recorder: mgr.GetEventRecorderFor(eventSource),
 	}
 }
 
@@ -82,6 +96,13 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	scalingPolicy, err := policy.New(config)
+	if err != nil {
+		return err
+	}
+
+	tracer := newTracer(config)
+
 	kubeclient := kubernetes.NewForConfigOrDie(mgr.GetConfig())
 
 	log.Info("Checking service and namespace...", "service", config.Service, "namespace", config.Namespace)
@@ -147,8 +168,104 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	if usesSecrets(config) {
+		// secrets do not contain the labels of the service
+		secretsInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeclient, 0,
+			kubeinformers.WithNamespace(config.Namespace))
+
+		err = mgr.Add(manager.RunnableFunc(func(s <-chan struct{}) error {
+			secretsInformerFactory.Start(s)
+			<-s
+
+			return nil
+		}))
+		if err != nil {
+			return err
+		}
+
+		// reconcile when the certificates are rotated
+		err = c.Watch(
+			&source.Informer{Informer: secretsInformerFactory.Core().V1().Secrets().Informer()},
+			&handler.EnqueueRequestForObject{},
+			predicate.Funcs{
+				CreateFunc: func(e event.CreateEvent) bool {
+					return isReferencedSecret(config, e.Meta.GetName())
+				},
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					return isReferencedSecret(config, e.MetaNew.GetName())
+				},
+				DeleteFunc: func(e event.DeleteEvent) bool {
+					return isReferencedSecret(config, e.Meta.GetName())
+				},
+				GenericFunc: func(e event.GenericEvent) bool {
+					return isReferencedSecret(config, e.Meta.GetName())
+				},
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		r.(*ReconcileTraffic).secretsLister = secretsInformerFactory.Core().V1().Secrets().Lister()
+	}
+
+	events := &eventRecorder{
+		recorder: mgr.GetEventRecorderFor(eventSource),
+		service:  service,
+	}
+
+	collector := metrics.NewCollector(config.IdleWindow)
+
+	profile, err := loadProfile(config, kubeclient)
+	if err != nil {
+		log.Error(err, "loading traffic profile", "configmap", config.ProfileConfigMap)
+	} else if profile != nil {
+		collector.SetProfile(profile)
+	}
+
+	members, err := parseMembers(config.Dependencies)
+	if err != nil {
+		return err
+	}
+
+	engine := scaler.NewEngine(scalingPolicy, collector, &deploymentScaler{config, kubeclient, members}, policy.RealClock{}, config.Namespace, config.Deployment)
+	engine.SetActivation(scaler.NewActivation(config))
+	engine.SetStabilization(scaler.NewStabilization(config))
+
+	identity, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	elector := newLeaderElection(config, kubeclient, identity)
+
+	var peers *peerStore
+	if config.PeerHeartbeat > 0 {
+		peers = newPeerStore(config, kubeclient, collector, identity)
+		engine.SetPeers(peers)
+	}
+
 	err = mgr.Add(manager.RunnableFunc(func(s <-chan struct{}) error {
-		go setupScalingMonitor(config, kubeclient, s)
+		if tracer != nil {
+			go tracer.Start(s)
+		}
+
+		go collector.Start(s)
+		go persistProfile(config, kubeclient, collector, elector, s)
+		if peers != nil {
+			go peers.run(s)
+		}
+
+		if config.LeaderElection {
+			go func() {
+				err := elector.run(s)
+				if err != nil {
+					log.Error(err, "electing the leader", "lock", config.LeaderElectionID)
+				}
+			}()
+		}
+
+		go setupScalingMonitor(config, engine, elector, peers, kubeclient, events, tracer, s)
 		<-s
 
 		return nil
@@ -157,6 +274,24 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	if config.APIAddress != "" && config.APIToken != "" {
+		err = mgr.Add(manager.RunnableFunc(func(s <-chan struct{}) error {
+			return api.NewServer(elector.demand(engine), collector, config.APIToken).Start(config.APIAddress, s)
+		}))
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.DebugAddress != "" {
+		err = mgr.Add(manager.RunnableFunc(func(s <-chan struct{}) error {
+			return debug.NewServer(ngx, collector, engine).Start(config.DebugAddress, s)
+		}))
+		if err != nil {
+			return err
+		}
+	}
+
 	r.(*ReconcileTraffic).servicesLister = kubeInformerFactory.Core().V1().Services().Lister()
 	r.(*ReconcileTraffic).podsLister = kubeInformerFactory.Core().V1().Pods().Lister()
 
@@ -177,8 +312,11 @@ type ReconcileTraffic struct {
 
 	nginx nginx.NGINX
 
+	recorder record.EventRecorder
+
 	servicesLister listerscorev1.ServiceLister
 	podsLister     listerscorev1.PodLister
+	secretsLister  listerscorev1.SecretLister
 
 	labelsSelector labels.Selector
 }
@@ -186,6 +324,15 @@ type ReconcileTraffic struct {
 // Reconcile reads that state of the cluster for a Traffic object and makes changes based on the state read
 // and what is in the Traffic.Spec
 func (r *ReconcileTraffic) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	result, err := r.reconcile()
+	if err != nil {
+		reconcileErrors.WithLabelValues(target(r.Configuration)).Inc()
+	}
+
+	return result, err
+}
+
+func (r *ReconcileTraffic) reconcile() (reconcile.Result, error) {
 	namespace := r.Configuration.Namespace
 	service := r.Configuration.Service
 
@@ -220,81 +367,260 @@ func (r *ReconcileTraffic) Reconcile(request reconcile.Request) (reconcile.Resul
 		return reconcile.Result{}, err
 	}
 
+	cfg.General = generalConfiguration(r.Configuration)
+
+	tls, err := upstreamTLS(r.Configuration, r.secretsLister)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	for i := range cfg.Servers {
+		cfg.Servers[i].Scheme = r.Configuration.UpstreamScheme
+		cfg.Servers[i].UpstreamTLS = tls
+	}
+
 	err = r.nginx.Update(cfg)
 	if err != nil {
+		if _, ok := err.(*nginx.ReloadError); ok {
+			r.recorder.Eventf(svc, corev1.EventTypeWarning, reasonReloadFailed, "NGINX failed to reload the configuration: %v", err)
+		}
+
 		return reconcile.Result{}, err
 	}
 
 	return reconcile.Result{}, nil
 }
 
-func setupScalingMonitor(config *env.Spec, client kubernetes.Interface, stopCh <-chan struct{}) {
-	collector := metrics.NewCollector()
-
-	go collector.Start(stopCh)
-
-	idleAfter := *config.IdleAfter
+func setupScalingMonitor(config *env.Spec, engine *scaler.Engine, elector *leaderElection, peers *peerStore, client kubernetes.Interface, events *eventRecorder, tracer *tracing.Tracer, stopCh <-chan struct{}) {
+	status := &statusReporter{config: config, client: client}
+	waits := &metrics.HeldWaits{}
 
 	for c := time.Tick(5 * time.Second); ; {
 		select {
 		case <-c:
-			stats := collector.CurrentStats()
-			log.V(2).Info("metrics", "lastRequest", stats.LastRequest, "idleAfter", idleAfter, "endpointCount", stats.EndpointCount)
+			// held requests are obtained before the scale operation releases them
+			held, err := metrics.GetHeld()
+			if err != nil {
+				log.Error(err, "obtaining held requests")
+				held = &metrics.Held{}
+			}
 
-			if stats.WaitingForPods {
-				log.Info("Scaling deployment up due pending requests")
-				err := scaleDeployment(config.Namespace, config.Deployment, int32(1), client)
-				if err != nil {
-					log.Error(err, "scaling deployment to 1 replica")
+			for _, wait := range waits.Update(held.Released) {
+				heldRequestWait.WithLabelValues(target(config)).Observe(wait.Seconds())
+			}
+
+			if !elector.isLeader() {
+				// only the leader scales the deployment. The activity of the replica is still shared
+				r := engine.Observe()
+				if peers != nil {
+					peers.record(r)
 				}
 
 				continue
 			}
 
-			if stats.EndpointCount == 0 {
-				// avoid access to apiserver running unnecessary scaling action
-				continue
+			err = applyAnnotations(config, client, engine)
+			if err != nil {
+				log.Error(err, "applying the annotations of the deployment")
+			}
+
+			if held.Trigger != nil {
+				engine.SetHeldSince(held.Trigger.StartTime())
+			}
+
+			r := engine.Step()
+			recordScaleResult(config, events, r, held.Trigger)
+
+			if peers != nil {
+				peers.record(r)
 			}
 
-			if stats.LastRequest >= int(idleAfter.Seconds()) && stats.PendingRequests <= 1 {
-				log.Info("Scaling deployment to zero due inactivity", "after", idleAfter)
-				err := scaleDeployment(config.Namespace, config.Deployment, int32(0), client)
+			if r.Scaled() && r.Direction == scaler.Up {
+				err := recordWakeStatus(config, client, r, held.Trigger)
 				if err != nil {
-					log.Error(err, "scaling deployment to 0 replicas")
+					log.Error(err, "recording wake status")
 				}
 			}
+
+			if tracer != nil && r.Direction != "" && (r.Deployment != nil || r.Err != nil) {
+				tracer.Record(scaleSpan(config, r, held.Requests))
+			}
+
+			err = status.report(engine.Status())
+			if err != nil {
+				log.Error(err, "reporting status")
+			}
 		case <-stopCh:
 			return
 		}
 	}
 }
 
-func scaleDeployment(namespace, name string, replicas int32, client kubernetes.Interface) error {
+// recordScaleResult logs the evaluation of the scaling engine and records metrics and events.
+// The trigger is the first held request, if the deployment was woken by a request
+func recordScaleResult(config *env.Spec, events *eventRecorder, r *scaler.Result, trigger *metrics.HeldRequest) {
+	name := target(config)
+	stats := r.Stats
+	decision := r.Decision
+
+	log.V(2).Info("metrics", "lastRequest", stats.LastRequest, "pendingRequests", stats.PendingRequests, "endpointCount", stats.EndpointCount)
+
+	if r.AvoidedColdStart {
+		avoidedColdStarts.WithLabelValues(name).Inc()
+	}
+
+	if r.ColdStart > 0 {
+		coldStartDuration.WithLabelValues(name).Observe(r.ColdStart.Seconds())
+	}
+
+	if r.Direction == "" {
+		return
+	}
+
+	scaleOperations.WithLabelValues(name, r.Direction, result(r.Err)).Inc()
+	if r.Err != nil {
+		log.Error(r.Err, "scaling deployment", "replicas", r.Replicas, "policy", decision.Policy)
+		recordScaleError(events, r.Deployment, config, r.Replicas, r.Err, stats)
+		return
+	}
+
+	if r.Deployment == nil {
+		// already scaled
+		return
+	}
+
+	scaleDuration.WithLabelValues(name, r.Direction).Observe(r.Duration.Seconds())
+
+	switch r.Direction {
+	case scaler.Up:
+		wakeups.WithLabelValues(name, decision.Policy, triggerLabel(config, trigger)).Inc()
+
+		reason := decision.Reason
+		if trigger != nil {
+			reason = fmt.Sprintf("%v, %v", reason, describeTrigger(trigger))
+		}
+
+		log.Info("Scaled deployment up", "replicas", r.Replicas, "policy", decision.Policy, "reason", reason)
+		events.event(r.Deployment, corev1.EventTypeNormal, reasonWake,
+			"Scaled deployment %v to %v replicas: %v (policy %v, %v)", config.Deployment, r.Replicas,
+			reason, decision.Policy, describeStats(stats))
+	case scaler.Down:
+		log.Info("Scaled deployment to zero due inactivity", "policy", decision.Policy, "reason", decision.Reason)
+		events.event(r.Deployment, corev1.EventTypeNormal, reasonSleep,
+			"Scaled deployment %v to zero due inactivity: %v (policy %v, %v)", config.Deployment,
+			decision.Reason, decision.Policy, describeStats(stats))
+	}
+}
+
+// recordScaleError records an event with the reason of a failed scale operation
+func recordScaleError(events *eventRecorder, deployment *appsv1.Deployment, config *env.Spec, replicas int32, err error, stats *metrics.Proxy) {
+	if err == wait.ErrWaitTimeout {
+		events.event(deployment, corev1.EventTypeWarning, reasonActivationTimeout,
+			"Deployment %v did not reach %v ready replicas after %v (%v)", config.Deployment, replicas, config.ActivationTimeout, describeStats(stats))
+		return
+	}
+
+	events.event(deployment, corev1.EventTypeWarning, reasonScaleFailed,
+		"Error scaling deployment %v to %v replicas: %v (%v)", config.Deployment, replicas, err, describeStats(stats))
+}
+
+// deploymentScaler is the scaler.Client that changes the replicas of the deployment in the cluster
+type deploymentScaler struct {
+	config *env.Spec
+	client kubernetes.Interface
+
+	// members of the wake group of the deployment, in activation order
+	members []member
+}
+
+// Scale changes the replicas of the deployment and waits until the ready replicas are the desired ones.
+// The members of the wake group are woken before the deployment and sleep with it
+func (s *deploymentScaler) Scale(replicas int32) (*appsv1.Deployment, error) {
+	if replicas > 0 {
+		// held requests are released once the deployment is ready and require the dependencies
+		err := wakeGroup(s.config, s.client, s.members)
+		if err != nil {
+			return nil, err
+		}
+
+		return scaleDeployment(s.config.Namespace, s.config.Deployment, replicas, s.config.ActivationTimeout, s.client)
+	}
+
+	deployment, err := s.client.AppsV1().Deployments(s.config.Namespace).Get(s.config.Deployment, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// a dependency of other deployments sleeps when all of them are asleep
+	if dependents := awakeDependents(deployment); len(dependents) > 0 {
+		log.V(2).Info("Deployment is required by other awake deployments", "dependents", dependents)
+		return nil, nil
+	}
+
+	// the members are checked before the deployment sleeps to postpone the sleep of the whole group
+	name, busy, err := busyGroup(s.config, s.client, s.members)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != "" {
+		log.Info("Sleep postponed, dependency is not idle", "deployment", name, "proxies", busy)
+		return nil, nil
+	}
+
+	deployment, err = scaleDeployment(s.config.Namespace, s.config.Deployment, 0, s.config.ActivationTimeout, s.client)
+	if err != nil {
+		return deployment, err
+	}
+
+	return deployment, sleepGroup(s.config, s.client, s.members)
+}
+
+// target returns the name used to identify the deployment in metrics
+func target(config *env.Spec) string {
+	return fmt.Sprintf("%v/%v", config.Namespace, config.Deployment)
+}
+
+// scaleDeployment changes the replicas of a deployment and waits until the
+// ready replicas are the desired ones. Scaling up sets the minimum number of
+// replicas. Returns nil if no change was required.
+func scaleDeployment(namespace, name string, replicas int32, timeout time.Duration, client kubernetes.Interface) (*appsv1.Deployment, error) {
 	deployment, err := client.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if *deployment.Spec.Replicas == replicas {
-		log.V(2).Info("No need to scale the deployment. Already scaled", "replicas", replicas)
-		return nil
+	current := *deployment.Spec.Replicas
+
+	// scaling up never reduces the replicas, i.e. set by an HPA
+	if current == replicas || (replicas > 0 && current > replicas) {
+		log.V(2).Info("No need to scale the deployment. Already scaled", "replicas", current)
+		return nil, nil
 	}
 
 	deployment.Spec.Replicas = &replicas
 
-	_, err = client.AppsV1().Deployments(namespace).Update(deployment)
+	deployment, err = client.AppsV1().Deployments(namespace).Update(deployment)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for c := time.NewTicker(70 * time.Second); ; <-c.C {
-		deployment, err := client.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	return deployment, waitForReplicas(namespace, name, replicas, timeout, client)
+}
+
+// waitForReplicas waits until the ready replicas of a deployment are the desired ones
+func waitForReplicas(namespace, name string, replicas int32, timeout time.Duration, client kubernetes.Interface) error {
+	// check frequently to report an accurate cold start duration
+	return wait.PollImmediate(1*time.Second, timeout, func() (bool, error) {
+		current, err := client.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
 		if err != nil {
-			return err
+			return false, err
 		}
 
-		if deployment.Status.ReadyReplicas == replicas {
-			return nil
+		if replicas == 0 {
+			return current.Status.ReadyReplicas == 0, nil
 		}
-	}
+
+		return current.Status.ReadyReplicas >= replicas, nil
+	})
 }
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+// stabilizationAnnotation annotation of the service with the stabilization of the deployment
+const stabilizationAnnotation = "horus-proxy/stabilization"
+
+// annotateService sets an annotation of the service handled by the proxy
+func annotateService(config *env.Spec, client kubernetes.Interface, name, value string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				name: value,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = client.CoreV1().Services(config.Namespace).Patch(config.Service, types.MergePatchType, patch)
+	return err
+}
+
+// statusReporter reports the stabilization of the deployment in an
+// annotation of the service when it changes
+type statusReporter struct {
+	config *env.Spec
+	client kubernetes.Interface
+
+	last string
+}
+
+// report updates the annotation of the service and the metrics with the stabilization of the deployment
+func (s *statusReporter) report(status scaler.Status) error {
+	flapping := 0.0
+	if status.Flapping {
+		flapping = 1
+	}
+
+	flappingTargets.WithLabelValues(target(s.config)).Set(flapping)
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	if string(data) == s.last {
+		return nil
+	}
+
+	err = annotateService(s.config, s.client, stabilizationAnnotation, string(data))
+	if err != nil {
+		return err
+	}
+
+	s.last = string(data)
+
+	return nil
+}
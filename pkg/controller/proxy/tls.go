@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/nginx"
+)
+
+const (
+	caCertKey = "ca.crt"
+)
+
+// upstreamTLS returns the TLS configuration used to connect to the pods,
+// writing the certificates defined in secrets to disk.
+func upstreamTLS(config *env.Spec, secrets listerscorev1.SecretLister) (nginx.UpstreamTLS, error) {
+	tls := nginx.UpstreamTLS{
+		ServerName:  config.UpstreamServerName,
+		VerifyDepth: config.UpstreamVerifyDepth,
+	}
+
+	if tls.ServerName == "" {
+		// the certificates of the pods are usually issued for the service
+		tls.ServerName = fmt.Sprintf("%v.%v.svc", config.Service, config.Namespace)
+	}
+
+	if config.UpstreamCASecret != "" {
+		secret, err := secrets.Secrets(config.Namespace).Get(config.UpstreamCASecret)
+		if err != nil {
+			return tls, err
+		}
+
+		ca, ok := secret.Data[caCertKey]
+		if !ok {
+			return tls, fmt.Errorf("secret %v/%v does not contain %v", secret.Namespace, secret.Name, caCertKey)
+		}
+
+		tls.CACertificate, err = nginx.WriteSSLCert(fmt.Sprintf("%v-%v-ca", secret.Namespace, secret.Name), ca)
+		if err != nil {
+			return tls, err
+		}
+	}
+
+	if config.UpstreamClientCertSecret != "" {
+		secret, err := secrets.Secrets(config.Namespace).Get(config.UpstreamClientCertSecret)
+		if err != nil {
+			return tls, err
+		}
+
+		cert, okCert := secret.Data[corev1.TLSCertKey]
+		key, okKey := secret.Data[corev1.TLSPrivateKeyKey]
+		if !okCert || !okKey {
+			return tls, fmt.Errorf("secret %v/%v does not contain %v and %v",
+				secret.Namespace, secret.Name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+		}
+
+		tls.ClientCertificate, err = nginx.WriteSSLCert(fmt.Sprintf("%v-%v", secret.Namespace, secret.Name), cert, key)
+		if err != nil {
+			return tls, err
+		}
+	}
+
+	return tls, nil
+}
+
+// usesSecrets returns true if the configuration references secrets
+func usesSecrets(config *env.Spec) bool {
+	return config.UpstreamCASecret != "" || config.UpstreamClientCertSecret != ""
+}
+
+// isReferencedSecret returns true if the secret is referenced in the configuration
+func isReferencedSecret(config *env.Spec, name string) bool {
+	return name == config.UpstreamCASecret || name == config.UpstreamClientCertSecret
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+	"github.com/aledbf/horus-proxy/pkg/tracing"
+)
+
+// maxSpanLinks maximum number of held requests linked to a scale span
+const maxSpanLinks = 32
+
+// newTracer returns a tracer if an OTLP endpoint is configured
+func newTracer(config *env.Spec) *tracing.Tracer {
+	if config.OTLPEndpoint == "" {
+		return nil
+	}
+
+	return tracing.NewTracer(tracing.NewOTLPExporter(config.OTLPEndpoint, map[string]string{
+		"service.name":        config.TracingServiceName,
+		"k8s.namespace.name":  config.Namespace,
+		"k8s.deployment.name": config.Deployment,
+	}))
+}
+
+// scaleSpan returns the span of a scale operation. A scale from zero due to
+// held requests is recorded in the trace of the oldest held request, as a
+// child of its held span, and linked to the traces of the other requests.
+func scaleSpan(config *env.Spec, r *scaler.Result, held []metrics.HeldRequest) *tracing.Span {
+	span := &tracing.Span{
+		TraceID: tracing.NewTraceID(),
+		SpanID:  tracing.NewSpanID(),
+		Name:    "scale " + r.Direction,
+		Kind:    tracing.SpanKindInternal,
+		Start:   r.Time,
+		End:     r.Time.Add(r.Duration),
+		Attributes: map[string]string{
+			"horus.target":        target(config),
+			"horus.direction":     r.Direction,
+			"horus.replicas":      fmt.Sprintf("%v", r.Replicas),
+			"horus.policy":        r.Decision.Policy,
+			"horus.reason":        r.Decision.Reason,
+			"horus.held_requests": fmt.Sprintf("%v", len(held)),
+		},
+	}
+
+	if r.Err != nil {
+		span.Error = r.Err.Error()
+	}
+
+	sort.SliceStable(held, func(i, j int) bool {
+		return held[i].Start < held[j].Start
+	})
+
+	parent := false
+	for _, request := range held {
+		// spans of requests that are not sampled are not exported
+		if request.TraceID == "" || !request.Sampled {
+			continue
+		}
+
+		if !parent {
+			span.TraceID = request.TraceID
+			span.ParentSpanID = request.SpanID
+			parent = true
+			continue
+		}
+
+		if len(span.Links) == maxSpanLinks {
+			break
+		}
+
+		span.Links = append(span.Links, tracing.Link{TraceID: request.TraceID, SpanID: request.SpanID})
+	}
+
+	return span
+}
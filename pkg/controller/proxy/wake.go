@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+// lastWakeAnnotation annotation of the service with the last activation of the deployment
+const lastWakeAnnotation = "horus-proxy/last-wake"
+
+// wakeStatus describes the last activation of the deployment
+type wakeStatus struct {
+	// Time the deployment was scaled up
+	Time time.Time `json:"time"`
+	// Replicas requested
+	Replicas int32 `json:"replicas"`
+	// Policy that decided to wake the deployment
+	Policy string `json:"policy"`
+	// Reason of the decision
+	Reason string `json:"reason"`
+	// Request first held request. Empty if the deployment was not woken by a request
+	Request *metrics.HeldRequest `json:"request,omitempty"`
+}
+
+// otherTrigger label of the wakeups by requests with an attribute not defined in the configuration
+const otherTrigger = "other"
+
+// methods valid values of the method label
+var methods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "DELETE": true,
+	"CONNECT": true, "OPTIONS": true, "TRACE": true, "PATCH": true,
+}
+
+// triggerLabel returns the value of the configured request attribute used
+// to label the wakeups. Empty if the deployment was not woken by a request.
+// The attributes are set by the clients, so only known values are used as label
+func triggerLabel(config *env.Spec, request *metrics.HeldRequest) string {
+	if request == nil {
+		return ""
+	}
+
+	switch config.WakeupLabel {
+	case "backend":
+		return request.Backend
+	case "method":
+		if methods[request.Method] {
+			return request.Method
+		}
+
+		return otherTrigger
+	case "path":
+		for _, prefix := range config.WakeupLabelValues {
+			if strings.HasPrefix(request.Path, prefix) {
+				return prefix
+			}
+		}
+
+		return otherTrigger
+	}
+
+	value := request.Host
+	switch config.WakeupLabel {
+	case "userAgent":
+		value = request.UserAgent
+	case "client":
+		value = request.Client
+	}
+
+	for _, allowed := range config.WakeupLabelValues {
+		if value == allowed {
+			return value
+		}
+	}
+
+	return otherTrigger
+}
+
+// describeTrigger returns a human readable version of the request that woke the deployment
+func describeTrigger(request *metrics.HeldRequest) string {
+	if request == nil {
+		return ""
+	}
+
+	parts := []string{fmt.Sprintf("triggered by %v %v%v from %v", request.Method, request.Host, request.Path, request.Client)}
+	if request.UserAgent != "" {
+		parts = append(parts, fmt.Sprintf("user agent %q", request.UserAgent))
+	}
+
+	if request.TraceID != "" {
+		parts = append(parts, fmt.Sprintf("trace %v", request.TraceID))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// recordWakeStatus stores the last activation of the deployment in an annotation of the service
+func recordWakeStatus(config *env.Spec, client kubernetes.Interface, r *scaler.Result, request *metrics.HeldRequest) error {
+	status, err := json.Marshal(&wakeStatus{
+		Time:     r.Time,
+		Replicas: r.Replicas,
+		Policy:   r.Decision.Policy,
+		Reason:   r.Decision.Reason,
+		Request:  request,
+	})
+	if err != nil {
+		return err
+	}
+
+	return annotateService(config, client, lastWakeAnnotation, string(status))
+}
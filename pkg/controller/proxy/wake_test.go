@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+)
+
+func TestTriggerLabel(t *testing.T) {
+	request := &metrics.HeldRequest{
+		Backend:   "default-http-svc-80",
+		Method:    "GET",
+		Host:      "app.example.com",
+		Path:      "/api/users/1",
+		UserAgent: "curl/7.64.0",
+		Client:    "10.0.0.1",
+	}
+
+	scenarios := []struct {
+		label   string
+		values  []string
+		request *metrics.HeldRequest
+		trigger string
+	}{
+		// 0: Not woken by a request
+		{label: "backend", trigger: ""},
+		// 1: Backend
+		{label: "backend", request: request, trigger: "default-http-svc-80"},
+		// 2: Standard method
+		{label: "method", request: request, trigger: "GET"},
+		// 3: Unknown method
+		{label: "method", request: &metrics.HeldRequest{Method: "PURGE"}, trigger: "other"},
+		// 4: Host in the allowed values
+		{label: "host", values: []string{"app.example.com"}, request: request, trigger: "app.example.com"},
+		// 5: Host not in the allowed values
+		{label: "host", request: request, trigger: "other"},
+		// 6: Path prefix
+		{label: "path", values: []string{"/static", "/api"}, request: request, trigger: "/api"},
+		// 7: User agent not in the allowed values
+		{label: "userAgent", values: []string{"kube-probe"}, request: request, trigger: "other"},
+		// 8: Client in the allowed values
+		{label: "client", values: []string{"10.0.0.1"}, request: request, trigger: "10.0.0.1"},
+	}
+
+	for i, scenario := range scenarios {
+		config := &env.Spec{WakeupLabel: scenario.label, WakeupLabelValues: scenario.values}
+
+		trigger := triggerLabel(config, scenario.request)
+		if trigger != scenario.trigger {
+			t.Errorf("%v: expected trigger %q but got %q", i, scenario.trigger, trigger)
+		}
+	}
+}
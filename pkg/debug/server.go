@@ -0,0 +1,171 @@
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+	"github.com/aledbf/horus-proxy/pkg/nginx"
+	"github.com/aledbf/horus-proxy/pkg/scaler"
+)
+
+var log = logf.Log.WithName("controller").WithName("debug")
+
+// HeldRequest is a request waiting for endpoints and the time it has been held
+type HeldRequest struct {
+	metrics.HeldRequest
+	// Age time the request has been held
+	Age string `json:"age"`
+}
+
+// State is the information returned by the debug server
+type State struct {
+	// Configuration running in NGINX
+	Configuration *nginx.Configuration `json:"configuration"`
+	// Pushes last dynamic configuration updates sent to NGINX
+	Pushes []nginx.Push `json:"pushes"`
+	// Stats latest stats of the proxy
+	Stats []metrics.Snapshot `json:"stats"`
+	// HeldRequests requests waiting for endpoints
+	HeldRequests []HeldRequest `json:"heldRequests"`
+	// Decisions latest decisions of the scaling engine
+	Decisions []scaler.DecisionRecord `json:"decisions"`
+	// Status stabilization of the deployment
+	Status scaler.Status `json:"status"`
+}
+
+// Server exposes the internal state of the proxy using HTTP
+type Server struct {
+	nginx     nginx.NGINX
+	collector *metrics.Collector
+	engine    *scaler.Engine
+
+	// heldRequests returns the requests waiting for endpoints
+	heldRequests func() ([]metrics.HeldRequest, error)
+}
+
+// NewServer returns a debug server
+func NewServer(ngx nginx.NGINX, collector *metrics.Collector, engine *scaler.Engine) *Server {
+	return &Server{
+		nginx:        ngx,
+		collector:    collector,
+		engine:       engine,
+		heldRequests: metrics.GetHeldRequests,
+	}
+}
+
+// Handler returns the HTTP handler of the debug endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug", func(w http.ResponseWriter, r *http.Request) {
+		held, err := s.held()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, &State{
+			Configuration: s.nginx.RunningConfiguration(),
+			Pushes:        s.nginx.Pushes(),
+			Stats:         s.collector.Snapshots(),
+			HeldRequests:  held,
+			Decisions:     s.engine.Decisions(),
+			Status:        s.engine.Status(),
+		})
+	})
+
+	mux.HandleFunc("/debug/configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.nginx.RunningConfiguration())
+	})
+
+	mux.HandleFunc("/debug/pushes", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.nginx.Pushes())
+	})
+
+	mux.HandleFunc("/debug/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.collector.Snapshots())
+	})
+
+	mux.HandleFunc("/debug/held", func(w http.ResponseWriter, r *http.Request) {
+		held, err := s.held()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, held)
+	})
+
+	mux.HandleFunc("/debug/decisions", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.engine.Decisions())
+	})
+
+	mux.HandleFunc("/debug/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.engine.Status())
+	})
+
+	return mux
+}
+
+// Start runs the debug server in address until the stop channel is closed
+func (s *Server) Start(address string, stopCh <-chan struct{}) error {
+	server := &http.Server{
+		Addr:    address,
+		Handler: s.Handler(),
+	}
+
+	go func() {
+		<-stopCh
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(ctx)
+	}()
+
+	log.Info("Starting debug server", "address", address)
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// held returns the requests waiting for endpoints with the time they have been held
+func (s *Server) held() ([]HeldRequest, error) {
+	requests, err := s.heldRequests()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	held := make([]HeldRequest, 0, len(requests))
+	for _, request := range requests {
+		start := time.Unix(0, int64(request.Start*float64(time.Second)))
+		held = append(held, HeldRequest{
+			HeldRequest: request,
+			Age:         now.Sub(start).Round(time.Millisecond).String(),
+		})
+	}
+
+	return held, nil
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(data)
+	if err != nil {
+		log.Error(err, "encoding debug response")
+	}
+}
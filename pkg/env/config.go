@@ -1,9 +1,13 @@
 package env
 
 import (
+	"fmt"
+	"net"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
+
+	"github.com/aledbf/horus-proxy/pkg/nginx"
 )
 
 // Spec hold configuration of the proxy to build
@@ -12,6 +16,147 @@ type Spec struct {
 	Deployment string         `required:"true" envconfig:"DEPLOYMENT"`
 	Service    string         `required:"true" envconfig:"SERVICE"`
 	IdleAfter  *time.Duration `envconfig:"IDLE_AFTER"`
+
+	// Policies names of the policies used to decide when the deployment sleeps or wakes.
+	// More than one policy are combined with the composite policy
+	Policies []string `default:"last-request" envconfig:"POLICIES"`
+	// IdleWindow period of time evaluated by the rate-window policy
+	IdleWindow time.Duration `default:"5m" envconfig:"IDLE_WINDOW"`
+	// IdleMaxRequests the deployment is idle with fewer requests in the IdleWindow. Zero disables the check
+	IdleMaxRequests int64 `default:"0" envconfig:"IDLE_MAX_REQUESTS"`
+	// IdleMaxRate the deployment is idle with less requests per second in the IdleWindow. Zero disables the check
+	IdleMaxRate float64 `default:"0" envconfig:"IDLE_MAX_RATE"`
+
+	// ScheduleAwake period of the day (HH:MM-HH:MM) the schedule policy keeps the deployment awake
+	ScheduleAwake string `default:"09:00-18:00" envconfig:"SCHEDULE_AWAKE"`
+	// ScheduleDays days of the week the ScheduleAwake period starts
+	ScheduleDays []string `default:"Mon,Tue,Wed,Thu,Fri" envconfig:"SCHEDULE_DAYS"`
+	// ScheduleTimezone timezone used to evaluate the ScheduleAwake period
+	ScheduleTimezone string `default:"UTC" envconfig:"SCHEDULE_TIMEZONE"`
+	// ScheduleMinReplicas minimum number of replicas during the ScheduleAwake period
+	ScheduleMinReplicas int32 `default:"1" envconfig:"SCHEDULE_MIN_REPLICAS"`
+	// ScheduleWindows windows (separated by ;) used by the windows policy to keep the deployment
+	// awake or force it to sleep, defined as <awake[:replicas]|sleep> <cron expression> <duration>
+	ScheduleWindows string `envconfig:"SCHEDULE_WINDOWS"`
+	// SchedulePrewarm time before a keep awake window the deployment is woken
+	SchedulePrewarm time.Duration `default:"0s" envconfig:"SCHEDULE_PREWARM"`
+
+	// PredictiveLead time before an usually busy hour the predictive policy wakes the deployment
+	PredictiveLead time.Duration `default:"10m" envconfig:"PREDICTIVE_LEAD"`
+	// PredictiveConfidence minimum ratio (0 to 1) of the past weeks with requests in the hour
+	PredictiveConfidence float64 `default:"0.7" envconfig:"PREDICTIVE_CONFIDENCE"`
+	// PredictiveMinWeeks minimum number of weeks observed before waking the deployment
+	PredictiveMinWeeks int `default:"2" envconfig:"PREDICTIVE_MIN_WEEKS"`
+	// ProfileConfigMap name of the configmap where the histogram of the requests by hour of the
+	// week is persisted. Defaults to <deployment>-traffic-profile
+	ProfileConfigMap string `envconfig:"PROFILE_CONFIGMAP"`
+
+	// MinAwake minimum time the deployment stays awake after a scale from zero
+	MinAwake time.Duration `default:"1m" envconfig:"MIN_AWAKE"`
+	// ScaleDownStabilization time the policies must decide to sleep continuously before scaling to zero
+	ScaleDownStabilization time.Duration `default:"0s" envconfig:"SCALE_DOWN_STABILIZATION"`
+	// FlapMaxWakes maximum number of scales from zero in the last hour before the deployment is
+	// considered flapping. Zero disables the detection
+	FlapMaxWakes int `default:"4" envconfig:"FLAP_MAX_WAKES"`
+	// FlapIdleExtension additional time a flapping deployment must be idle before scaling to zero
+	FlapIdleExtension time.Duration `default:"10m" envconfig:"FLAP_IDLE_EXTENSION"`
+
+	// Dependencies comma separated list of deployments (name or name:replicas) woken, in order,
+	// before the deployment and scaled to zero with it
+	Dependencies []string `envconfig:"DEPENDENCIES"`
+
+	// ActivationTimeout maximum time to wait for the deployment to reach the desired ready replicas
+	ActivationTimeout time.Duration `default:"5m" envconfig:"ACTIVATION_TIMEOUT"`
+	// ActivationTargetConcurrency number of held requests each replica absorbs in a scale from zero.
+	// Zero wakes the deployment with one replica
+	ActivationTargetConcurrency int `default:"0" envconfig:"ACTIVATION_TARGET_CONCURRENCY"`
+	// ActivationMaxReplicas maximum number of replicas of a scale from zero due held requests
+	ActivationMaxReplicas int32 `default:"10" envconfig:"ACTIVATION_MAX_REPLICAS"`
+
+	// OutlierConsecutiveFailures number of consecutive failures before ejecting an endpoint. Zero disables ejection
+	OutlierConsecutiveFailures int `default:"5" envconfig:"OUTLIER_CONSECUTIVE_FAILURES"`
+	// OutlierEjectionTime time an ejected endpoint does not receive traffic
+	OutlierEjectionTime time.Duration `default:"30s" envconfig:"OUTLIER_EJECTION_TIME"`
+	// OutlierMaxEjectionPercent maximum percentage of endpoints that can be ejected
+	OutlierMaxEjectionPercent int `default:"50" envconfig:"OUTLIER_MAX_EJECTION_PERCENT"`
+	// UpstreamRetries number of additional endpoints to try after a failure
+	UpstreamRetries int `default:"1" envconfig:"UPSTREAM_RETRIES"`
+
+	// SlowStartWindow maximum time held requests wait for MinReadyEndpoints or are paced after a scale from zero
+	SlowStartWindow time.Duration `default:"0s" envconfig:"SLOW_START_WINDOW"`
+	// MinReadyEndpoints number of ready endpoints required to release held requests during the SlowStartWindow
+	MinReadyEndpoints int `default:"1" envconfig:"MIN_READY_ENDPOINTS"`
+	// ReleaseRate maximum number of held requests released per second. Zero means no limit
+	ReleaseRate int `default:"0" envconfig:"RELEASE_RATE"`
+
+	// ForwardedHeaders sends the identity of the client to the endpoints using X-Forwarded-* and Forwarded headers
+	ForwardedHeaders bool `default:"true" envconfig:"FORWARDED_HEADERS"`
+	// TrustedCIDRs comma separated list of addresses of proxies allowed to set the forwarded headers.
+	// Only IPv4 is supported
+	TrustedCIDRs []string `envconfig:"TRUSTED_CIDRS"`
+	// UseProxyProtocol enables the PROXY protocol in the listeners
+	UseProxyProtocol bool `default:"false" envconfig:"USE_PROXY_PROTOCOL"`
+
+	// BackgroundPaths comma separated list of path prefixes of requests that are not activity
+	BackgroundPaths []string `envconfig:"BACKGROUND_PATHS"`
+	// BackgroundUserAgents comma separated list of substrings of the User-Agent of requests that are not activity
+	BackgroundUserAgents []string `envconfig:"BACKGROUND_USER_AGENTS"`
+	// BackgroundCIDRs comma separated list of addresses of clients whose requests are not activity
+	BackgroundCIDRs []string `envconfig:"BACKGROUND_CIDRS"`
+	// BackgroundHeaders comma separated list of headers (name or name=value) of requests that are not activity
+	BackgroundHeaders []string `envconfig:"BACKGROUND_HEADERS"`
+	// BackgroundWake allows requests that are not activity to wake the deployment.
+	// Otherwise they receive a 503 while the deployment is scaled to zero
+	BackgroundWake bool `default:"false" envconfig:"BACKGROUND_WAKE"`
+
+	// UpstreamScheme used to connect to the pods (http, https or grpcs)
+	UpstreamScheme string `default:"http" envconfig:"UPSTREAM_SCHEME"`
+	// UpstreamCASecret name of the secret with the CA (ca.crt) used to verify the certificates of the pods
+	UpstreamCASecret string `envconfig:"UPSTREAM_CA_SECRET"`
+	// UpstreamClientCertSecret name of the TLS secret (tls.crt and tls.key) presented to the pods
+	UpstreamClientCertSecret string `envconfig:"UPSTREAM_CLIENT_CERT_SECRET"`
+	// UpstreamServerName name used in SNI and to verify the certificates of the pods
+	UpstreamServerName string `envconfig:"UPSTREAM_SERVER_NAME"`
+	// UpstreamVerifyDepth maximum depth of the chain of the certificates of the pods
+	UpstreamVerifyDepth int `default:"2" envconfig:"UPSTREAM_VERIFY_DEPTH"`
+
+	// OTLPEndpoint URL of the OpenTelemetry collector (OTLP/HTTP) receiving the spans. Empty disables tracing
+	OTLPEndpoint string `envconfig:"OTLP_ENDPOINT"`
+	// TracingServiceName name of the service reported in the spans
+	TracingServiceName string `default:"horus-proxy" envconfig:"TRACING_SERVICE_NAME"`
+	// TracingSampleRatio ratio of new traces recorded (0 to 1)
+	TracingSampleRatio float64 `default:"1" envconfig:"TRACING_SAMPLE_RATIO"`
+
+	// WakeupLabel attribute of the request that woke the deployment used to label the wakeups
+	// metric (host, method, path, userAgent, client or backend)
+	WakeupLabel string `default:"backend" envconfig:"WAKEUP_LABEL"`
+	// WakeupLabelValues comma separated list of values of the attribute used as label. Other values
+	// are labelled as other. Paths are prefixes. Not used by the method and backend attributes
+	WakeupLabelValues []string `envconfig:"WAKEUP_LABEL_VALUES"`
+
+	// PeerHeartbeat time between updates of the activity shared with the other replicas of
+	// the proxy. The deployment sleeps only when all the replicas are idle. Zero disables it
+	PeerHeartbeat time.Duration `default:"10s" envconfig:"PEER_HEARTBEAT"`
+	// PeersConfigMap name of the configmap where the replicas of the proxy share their activity.
+	// Defaults to <deployment>-proxy-activity
+	PeersConfigMap string `envconfig:"PEERS_CONFIGMAP"`
+
+	// LeaderElection elects a replica of the proxy to take the scaling decisions. The other
+	// replicas only serve the traffic and share their activity
+	LeaderElection bool `default:"true" envconfig:"LEADER_ELECTION"`
+	// LeaderElectionID name of the configmap used as lock. Defaults to <deployment>-proxy-leader
+	LeaderElectionID string `envconfig:"LEADER_ELECTION_ID"`
+	// LeaderElectionLeaseDuration time a replica waits to take the leadership after the leader stops renewing it
+	LeaderElectionLeaseDuration time.Duration `default:"10s" envconfig:"LEADER_ELECTION_LEASE_DURATION"`
+
+	// APIAddress address of the API to wake or sleep the deployment on demand. The token is sent in
+	// plain text, so the API must be fronted by TLS when exposed outside of the pod
+	APIAddress string `default:"127.0.0.1:10257" envconfig:"API_ADDRESS"`
+	// APIToken bearer token required by the API. Empty disables the API
+	APIToken string `envconfig:"API_TOKEN"`
+
+	// DebugAddress address of the debug server exposing the internal state of the proxy. Empty disables the server
+	DebugAddress string `default:"127.0.0.1:10256" envconfig:"DEBUG_ADDRESS"`
 }
 
 // Parse extracts the configuration defined by Environment variables
@@ -22,6 +167,74 @@ func Parse() (*Spec, error) {
 		return nil, err
 	}
 
+	switch s.UpstreamScheme {
+	case nginx.SchemeHTTP, nginx.SchemeHTTPS, nginx.SchemeGRPCS:
+	default:
+		return nil, fmt.Errorf("invalid upstream scheme %v (valid: %v, %v and %v)",
+			s.UpstreamScheme, nginx.SchemeHTTP, nginx.SchemeHTTPS, nginx.SchemeGRPCS)
+	}
+
+	if s.UpstreamVerifyDepth < 1 {
+		return nil, fmt.Errorf("invalid upstream verify depth %v", s.UpstreamVerifyDepth)
+	}
+
+	for _, cidr := range s.TrustedCIDRs {
+		ip, _, err := net.ParseCIDR(cidr)
+		if err != nil || ip.To4() == nil {
+			return nil, fmt.Errorf("invalid trusted CIDR %v (only IPv4 is supported)", cidr)
+		}
+	}
+
+	for _, cidr := range s.BackgroundCIDRs {
+		ip, _, err := net.ParseCIDR(cidr)
+		if err != nil || ip.To4() == nil {
+			return nil, fmt.Errorf("invalid background CIDR %v (only IPv4 is supported)", cidr)
+		}
+	}
+
+	switch s.WakeupLabel {
+	case "host", "method", "path", "userAgent", "client", "backend":
+	default:
+		return nil, fmt.Errorf("invalid wakeup label %v (valid: host, method, path, userAgent, client and backend)", s.WakeupLabel)
+	}
+
+	if s.ActivationTargetConcurrency < 0 || s.ActivationMaxReplicas < 1 {
+		return nil, fmt.Errorf("invalid activation target concurrency %v or max replicas %v", s.ActivationTargetConcurrency, s.ActivationMaxReplicas)
+	}
+
+	if s.MinAwake < 0 || s.ScaleDownStabilization < 0 || s.FlapMaxWakes < 0 || s.FlapIdleExtension < 0 {
+		return nil, fmt.Errorf("invalid stabilization: min awake %v, window %v, flap max wakes %v or flap idle extension %v",
+			s.MinAwake, s.ScaleDownStabilization, s.FlapMaxWakes, s.FlapIdleExtension)
+	}
+
+	if s.PredictiveConfidence < 0 || s.PredictiveConfidence > 1 {
+		return nil, fmt.Errorf("invalid predictive confidence %v (valid: 0 to 1)", s.PredictiveConfidence)
+	}
+
+	if s.ProfileConfigMap == "" {
+		s.ProfileConfigMap = s.Deployment + "-traffic-profile"
+	}
+
+	if s.PeersConfigMap == "" {
+		s.PeersConfigMap = s.Deployment + "-proxy-activity"
+	}
+
+	if s.PeerHeartbeat < 0 {
+		return nil, fmt.Errorf("invalid peer heartbeat %v", s.PeerHeartbeat)
+	}
+
+	if s.LeaderElectionID == "" {
+		s.LeaderElectionID = s.Deployment + "-proxy-leader"
+	}
+
+	if s.LeaderElectionLeaseDuration <= 0 {
+		return nil, fmt.Errorf("invalid leader election lease duration %v", s.LeaderElectionLeaseDuration)
+	}
+
+	if s.TracingSampleRatio < 0 || s.TracingSampleRatio > 1 {
+		return nil, fmt.Errorf("invalid tracing sample ratio %v (valid: 0 to 1)", s.TracingSampleRatio)
+	}
+
 	if s.IdleAfter == nil {
 		ia := time.Duration(90 * time.Second)
 		s.IdleAfter = &ia
@@ -2,34 +2,52 @@ package metrics
 
 import (
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"sync"
 	"time"
 
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 
-	"github.com/gojektech/heimdall"
-	"github.com/gojektech/heimdall/httpclient"
+	"github.com/aledbf/horus-proxy/pkg/nginx"
 )
 
 const (
-	metricPort = 19999
+	statsPath = "/stats"
+
+	// maxSnapshots number of stats kept by the collector
+	maxSnapshots = 60
 )
 
+// Snapshot is the aggregated stats of the proxy at a point in time
+type Snapshot struct {
+	Time  time.Time `json:"time"`
+	Stats *Proxy    `json:"stats"`
+}
+
 var log = logf.Log.WithName("controller").WithName("metrics")
 
 // Collector defines a metrics collector
 type Collector struct {
 	stats *Proxy
 
+	raw *Stats
+
+	history *history
+
+	profile *Profile
+
+	snapshots []Snapshot
+
 	mu *sync.RWMutex
 }
 
-// NewCollector returns a new Collector instance
-func NewCollector() *Collector {
+// NewCollector returns a new Collector instance that keeps
+// the number of requests processed during the retention period
+func NewCollector(retention time.Duration) *Collector {
 	return &Collector{
-		mu: &sync.RWMutex{},
+		history: newHistory(retention),
+		profile: &Profile{},
+		mu:      &sync.RWMutex{},
 	}
 }
 
@@ -45,62 +63,115 @@ func (c *Collector) CurrentStats() *Proxy {
 	return c.stats
 }
 
-// Start ...
+// Window returns the requests processed by the proxy in the last duration
+func (c *Collector) Window(duration time.Duration) *Window {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.history.window(duration)
+}
+
+// Record updates the current stats and the history of requests.
+// This allows to feed the collector with stats from another source (i.e. a simulation)
+func (c *Collector) Record(s *Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.raw != nil {
+		requests := s.requests() - c.raw.requests()
+		if requests < 0 {
+			// counters are reset when NGINX restarts
+			requests = s.requests()
+		}
+
+		c.profile.add(s.time(), requests)
+	}
+
+	c.stats = aggregate(s, c.raw)
+	c.raw = s
+	c.history.add(s.time(), s.requests())
+
+	c.snapshots = append(c.snapshots, Snapshot{Time: s.time(), Stats: c.stats})
+	if len(c.snapshots) > maxSnapshots {
+		c.snapshots = c.snapshots[len(c.snapshots)-maxSnapshots:]
+	}
+}
+
+// Requests returns the number of requests processed by the proxy since NGINX started
+func (c *Collector) Requests() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.raw == nil {
+		return 0
+	}
+
+	return c.raw.requests()
+}
+
+// AddRequests adds requests processed at a time by other replicas of the proxy to the
+// histogram, so the histogram contains all the traffic of the deployment
+func (c *Collector) AddRequests(t time.Time, requests int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.profile.add(t, requests)
+}
+
+// Profile returns the histogram of the requests by day of the week and hour of the day
+func (c *Collector) Profile() *Profile {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.profile.copy()
+}
+
+// SetProfile replaces the histogram of the requests, i.e. with one persisted by a previous instance
+func (c *Collector) SetProfile(p *Profile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.profile = p.copy()
+}
+
+// Snapshots returns the latest stats, from the oldest to the newest
+func (c *Collector) Snapshots() []Snapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snapshots := make([]Snapshot, len(c.snapshots))
+	copy(snapshots, c.snapshots)
+
+	return snapshots
+}
+
+// Start periodically collects the stats from NGINX
 func (c *Collector) Start(stopCh <-chan struct{}) {
 	for t := time.NewTicker(6 * time.Second); ; {
 		select {
 		case <-t.C:
-			p, err := getMetrics()
+			s, err := getStats()
 			if err != nil {
 				log.Error(err, "obtaining stats")
 				continue
 			}
 
-			c.mu.Lock()
-			c.stats = p
-			c.mu.Unlock()
+			c.Record(s)
 		case <-stopCh:
 			return
 		}
 	}
 }
 
-func getMetrics() (*Proxy, error) {
-	data, err := requestStats(fmt.Sprintf("http://127.0.0.1:%v/metrics", metricPort))
-	if err != nil {
-		return nil, err
-	}
-
-	p, err := parse(data)
-	if err != nil {
-		return nil, err
-	}
-
-	return p, nil
-}
-
-func requestStats(url string) ([]byte, error) {
-	httpClient := httpclient.NewClient(
-		httpclient.WithHTTPTimeout(10*time.Second),
-		httpclient.WithRetryCount(1),
-		httpclient.WithRetrier(
-			heimdall.NewRetrier(
-				heimdall.NewConstantBackoff(10*time.Millisecond, 50*time.Millisecond),
-			),
-		),
-	)
-
-	headers := http.Header{}
-	response, err := httpClient.Get(url, headers)
+func getStats() (*Stats, error) {
+	statusCode, data, err := nginx.NewGetStatusRequest(statsPath)
 	if err != nil {
 		return nil, err
 	}
-	defer response.Body.Close()
 
-	data, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %v obtaining stats", statusCode)
 	}
 
-	return data, nil
+	return parseStats(data)
 }
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/nginx"
+)
+
+const (
+	heldPath = "/held"
+)
+
+// HeldRequest is a request waiting for endpoints
+type HeldRequest struct {
+	// ID of the request (X-Request-ID)
+	ID string `json:"id"`
+	// Backend name of the backend
+	Backend string `json:"backend"`
+	Method  string `json:"method"`
+	Host    string `json:"host"`
+	Path    string `json:"path"`
+	// UserAgent value of the User-Agent header
+	UserAgent string `json:"userAgent"`
+	// Client address of the client
+	Client string `json:"client"`
+	// Start unix time (in seconds) the request started to be held
+	Start float64 `json:"start"`
+	// TraceID identifier of the trace of the request
+	TraceID string `json:"traceId"`
+	// SpanID identifier of the span of the held phase of the request
+	SpanID string `json:"spanId"`
+	// Sampled is true if the span of the held phase of the request is exported
+	Sampled bool `json:"sampled"`
+	// Released unix time (in seconds) the request stopped waiting. Zero while it is held
+	Released float64 `json:"released,omitempty"`
+}
+
+// StartTime returns the time the request started to be held
+func (r HeldRequest) StartTime() time.Time {
+	sec, dec := math.Modf(r.Start)
+	return time.Unix(int64(sec), int64(dec*1e9))
+}
+
+// Wait returns the time the request waited for endpoints. Zero while it is held
+func (r HeldRequest) Wait() time.Duration {
+	if r.Released == 0 {
+		return 0
+	}
+
+	return time.Duration((r.Released - r.Start) * float64(time.Second))
+}
+
+// Held is the document returned by the NGINX status server in /held
+type Held struct {
+	// Requests waiting for endpoints, from the oldest to the newest
+	Requests []HeldRequest `json:"requests"`
+	// Released requests that stopped waiting in the last minute
+	Released []HeldRequest `json:"released"`
+	// Trigger first request held since the deployment was active.
+	// It is the request that triggers the activation of the deployment
+	Trigger *HeldRequest `json:"trigger,omitempty"`
+}
+
+// GetHeld returns the requests waiting for endpoints and the request that
+// triggers the activation of the deployment
+func GetHeld() (*Held, error) {
+	statusCode, data, err := nginx.NewGetStatusRequest(heldPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %v obtaining held requests", statusCode)
+	}
+
+	held := &Held{}
+	err = json.Unmarshal(data, held)
+	if err != nil {
+		return nil, err
+	}
+
+	return held, nil
+}
+
+// GetHeldRequests returns the requests waiting for endpoints
+func GetHeldRequests() ([]HeldRequest, error) {
+	held, err := GetHeld()
+	if err != nil {
+		return nil, err
+	}
+
+	return held.Requests, nil
+}
+
+// HeldWaits reports the time each held request waited for endpoints once
+type HeldWaits struct {
+	// released requests reported by the previous update
+	reported map[string]bool
+}
+
+// Update returns the time the requests released since the previous update waited for endpoints
+func (w *HeldWaits) Update(released []HeldRequest) []time.Duration {
+	reported := make(map[string]bool, len(released))
+
+	var waits []time.Duration
+	for _, request := range released {
+		key := fmt.Sprintf("%v/%v", request.ID, request.Start)
+		reported[key] = true
+
+		if !w.reported[key] {
+			waits = append(waits, request.Wait())
+		}
+	}
+
+	w.reported = reported
+
+	return waits
+}
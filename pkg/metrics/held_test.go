@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHeldWaits(t *testing.T) {
+	w := &HeldWaits{}
+
+	first := HeldRequest{ID: "a", Start: 1000, Released: 1012.5}
+	second := HeldRequest{ID: "b", Start: 1001, Released: 1013}
+
+	// released requests are reported once while they are returned by the proxy
+	if waits := w.Update([]HeldRequest{first}); !reflect.DeepEqual(waits, []time.Duration{12500 * time.Millisecond}) {
+		t.Errorf("expected the wait of the first request but got %v", waits)
+	}
+
+	if waits := w.Update([]HeldRequest{first, second}); !reflect.DeepEqual(waits, []time.Duration{12 * time.Second}) {
+		t.Errorf("expected the wait of the second request but got %v", waits)
+	}
+
+	if waits := w.Update([]HeldRequest{second}); len(waits) != 0 {
+		t.Errorf("expected no waits but got %v", waits)
+	}
+
+	// a request with the same ID held again is a different request
+	again := HeldRequest{ID: "a", Start: 2000, Released: 2001}
+	if waits := w.Update([]HeldRequest{again}); !reflect.DeepEqual(waits, []time.Duration{time.Second}) {
+		t.Errorf("expected the wait of the request held again but got %v", waits)
+	}
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Window summarizes the requests processed by the proxy in a period of time
+type Window struct {
+	// Duration of the window
+	Duration time.Duration `json:"duration"`
+	// Requests number of requests processed in the window
+	Requests int64 `json:"requests"`
+	// Rate requests per second processed in the window
+	Rate float64 `json:"rate"`
+	// Complete is true if the collected stats cover the whole window,
+	// i.e. false right after the proxy started
+	Complete bool `json:"complete"`
+}
+
+type sample struct {
+	timestamp time.Time
+	requests  int64
+}
+
+// history keeps a time series of the number of requests processed by the proxy
+type history struct {
+	retention time.Duration
+	samples   []sample
+}
+
+func newHistory(retention time.Duration) *history {
+	return &history{
+		retention: retention,
+	}
+}
+
+// add appends a new sample removing the ones not required to cover the retention
+func (h *history) add(timestamp time.Time, requests int64) {
+	h.samples = append(h.samples, sample{timestamp, requests})
+
+	// keep the newest sample older than the retention to cover the whole period
+	cutoff := timestamp.Add(-h.retention)
+	first := 0
+	for i := range h.samples {
+		if h.samples[i].timestamp.After(cutoff) {
+			break
+		}
+		first = i
+	}
+
+	h.samples = h.samples[first:]
+}
+
+// window returns the requests processed in the duration ending in the last sample
+func (h *history) window(duration time.Duration) *Window {
+	w := &Window{
+		Duration: duration,
+	}
+
+	if len(h.samples) < 2 {
+		return w
+	}
+
+	last := h.samples[len(h.samples)-1]
+	start := last.timestamp.Add(-duration)
+
+	base := 0
+	for i := range h.samples {
+		if h.samples[i].timestamp.After(start) {
+			break
+		}
+		base = i
+		w.Complete = true
+	}
+
+	for i := base + 1; i < len(h.samples); i++ {
+		delta := h.samples[i].requests - h.samples[i-1].requests
+		if delta < 0 {
+			// counters are reset when NGINX restarts
+			delta = h.samples[i].requests
+		}
+
+		w.Requests += delta
+	}
+
+	elapsed := last.timestamp.Sub(h.samples[base].timestamp).Seconds()
+	if elapsed > 0 {
+		w.Rate = float64(w.Requests) / elapsed
+	}
+
+	return w
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryWindow(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	var scenarios = []struct {
+		samples  []int64
+		interval time.Duration
+		window   time.Duration
+		out      *Window
+	}{
+		// 0: No samples
+		{
+			samples:  []int64{},
+			interval: 10 * time.Second,
+			window:   time.Minute,
+			out:      &Window{Duration: time.Minute},
+		},
+		// 1: Samples do not cover the window
+		{
+			samples:  []int64{0, 10, 20},
+			interval: 10 * time.Second,
+			window:   time.Minute,
+			out:      &Window{Duration: time.Minute, Requests: 20, Rate: 1},
+		},
+		// 2: Only the samples in the window are used
+		{
+			samples:  []int64{0, 100, 100, 101, 101, 102, 102},
+			interval: 10 * time.Second,
+			window:   40 * time.Second,
+			out:      &Window{Duration: 40 * time.Second, Requests: 2, Rate: 0.05, Complete: true},
+		},
+		// 3: Counters reset
+		{
+			samples:  []int64{50, 60, 5, 10},
+			interval: 10 * time.Second,
+			window:   30 * time.Second,
+			out:      &Window{Duration: 30 * time.Second, Requests: 20, Rate: float64(20) / 30, Complete: true},
+		},
+	}
+
+	for i, scenario := range scenarios {
+		h := newHistory(scenario.window)
+		for j, requests := range scenario.samples {
+			h.add(start.Add(time.Duration(j)*scenario.interval), requests)
+		}
+
+		out := h.window(scenario.window)
+		if !reflect.DeepEqual(out, scenario.out) {
+			t.Errorf("%d. %+v is not equal to expected value %+v", i, out, scenario.out)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Slot summarizes the traffic of an hour of the week
+type Slot struct {
+	// Observed number of times the hour was observed
+	Observed int `json:"observed"`
+	// Active number of times the hour had requests
+	Active int `json:"active"`
+	// Requests number of requests processed in the hour
+	Requests int64 `json:"requests"`
+}
+
+// Confidence returns the ratio of the observations of the hour with requests
+func (s Slot) Confidence() float64 {
+	if s.Observed == 0 {
+		return 0
+	}
+
+	return float64(s.Active) / float64(s.Observed)
+}
+
+// observation is the hour being observed
+type observation struct {
+	// Start of the hour
+	Start time.Time `json:"start"`
+	// Requests processed since the start of the hour
+	Requests int64 `json:"requests"`
+}
+
+// Profile is a histogram of the requests processed by the proxy by day
+// of the week and hour of the day (in UTC) used to predict busy periods
+type Profile struct {
+	// Slots traffic by day of the week (Sunday first) and hour of the day
+	Slots [7][24]Slot `json:"slots"`
+	// Current hour being observed
+	Current *observation `json:"current,omitempty"`
+}
+
+// Slot returns the traffic of the hour of the week of a time
+func (p *Profile) Slot(t time.Time) Slot {
+	t = t.UTC()
+	return p.Slots[t.Weekday()][t.Hour()]
+}
+
+// add records the requests processed at a time. The traffic of an hour is
+// added to the slots once a request of the following hour is recorded
+func (p *Profile) add(t time.Time, requests int64) {
+	hour := t.UTC().Truncate(time.Hour)
+
+	if p.Current != nil && !p.Current.Start.Equal(hour) {
+		p.finish()
+	}
+
+	if p.Current == nil {
+		p.Current = &observation{Start: hour}
+	}
+
+	p.Current.Requests += requests
+}
+
+// finish adds the hour being observed to the slots
+func (p *Profile) finish() {
+	slot := &p.Slots[p.Current.Start.Weekday()][p.Current.Start.Hour()]
+
+	slot.Observed++
+	slot.Requests += p.Current.Requests
+	if p.Current.Requests > 0 {
+		slot.Active++
+	}
+
+	p.Current = nil
+}
+
+// copy returns a deep copy of the profile
+func (p *Profile) copy() *Profile {
+	out := *p
+	if p.Current != nil {
+		current := *p.Current
+		out.Current = &current
+	}
+
+	return &out
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProfile(t *testing.T) {
+	// Monday 2019-06-24 09:00 UTC
+	monday := time.Date(2019, 6, 24, 9, 0, 0, 0, time.UTC)
+
+	p := &Profile{}
+
+	for week := 0; week < 3; week++ {
+		start := monday.AddDate(0, 0, 7*week)
+
+		// requests between 09:00 and 10:00 except in the last week
+		if week < 2 {
+			p.add(start.Add(10*time.Minute), 5)
+		} else {
+			p.add(start.Add(10*time.Minute), 0)
+		}
+
+		// the hour is added to the slots with the first sample of the next hour
+		p.add(start.Add(time.Hour), 0)
+	}
+
+	slot := p.Slot(monday)
+	if slot.Observed != 3 || slot.Active != 2 || slot.Requests != 10 {
+		t.Errorf("unexpected slot %+v", slot)
+	}
+
+	if confidence := slot.Confidence(); confidence < 0.66 || confidence > 0.67 {
+		t.Errorf("expected a confidence of 0.66 but got %v", confidence)
+	}
+
+	// the hour being observed is not part of the slots yet
+	next := p.Slot(monday.Add(time.Hour))
+	if next.Observed != 2 || next.Active != 0 {
+		t.Errorf("unexpected slot %+v", next)
+	}
+
+	if p.Current == nil || !p.Current.Start.Equal(monday.AddDate(0, 0, 14).Add(time.Hour)) {
+		t.Errorf("unexpected current observation %+v", p.Current)
+	}
+
+	// copies are not modified by new samples
+	c := p.copy()
+	p.add(monday.AddDate(0, 0, 14).Add(90*time.Minute), 3)
+	if c.Current.Requests != 0 {
+		t.Errorf("expected the copy to be independent of the profile")
+	}
+}
@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// StatsVersion is the version of the stats document supported by the collector
+const StatsVersion = 1
+
+// Stats is the document returned by the NGINX status server in /stats
+type Stats struct {
+	// Version of the document
+	Version int `json:"version"`
+	// Timestamp unix time (in seconds) when the stats were collected
+	Timestamp float64 `json:"timestamp"`
+	// Endpoints number of unique addresses of the endpoints of all the backends (pods)
+	Endpoints int `json:"endpoints"`
+	// Backends stats of each backend (one per service port)
+	Backends []Backend `json:"backends"`
+}
+
+// Backend contains the stats of a backend
+type Backend struct {
+	// Name of the backend
+	Name string `json:"name"`
+	// HeldRequests number of requests waiting for endpoints
+	HeldRequests int `json:"heldRequests"`
+	// ActiveRequests number of requests being processed by the endpoints
+	ActiveRequests int `json:"activeRequests"`
+	// LastRequest unix time (in seconds) of the last request. If there
+	// was no request, the time the proxy started
+	LastRequest float64 `json:"lastRequest"`
+	// Endpoints number of endpoints
+	Endpoints int `json:"endpoints"`
+	// EjectedEndpoints number of endpoints ejected by the passive health checks
+	EjectedEndpoints int `json:"ejectedEndpoints"`
+	// Requests number of requests processed
+	Requests int64 `json:"requests"`
+	// Errors number of requests processed with a status code >= 500
+	Errors int64 `json:"errors"`
+	// StatusClasses number of requests processed by status class (i.e. 2xx)
+	StatusClasses map[string]int64 `json:"statusClasses,omitempty"`
+	// UpstreamTime sum of the response time (in seconds) of the endpoints
+	UpstreamTime float64 `json:"upstreamTime"`
+	// UpstreamRequests number of requests with a response from the endpoints
+	UpstreamRequests int64 `json:"upstreamRequests"`
+	// BackgroundRequests number of requests that are not activity of the deployment
+	// (i.e. probes). Not included in the other counters
+	BackgroundRequests int64 `json:"backgroundRequests"`
+}
+
+// Target contains the stats of a backend of the proxy
+type Target struct {
+	// Name of the backend
+	Name string `json:"name"`
+	// HeldRequests number of requests waiting for pods
+	HeldRequests int `json:"heldRequests"`
+	// PendingRequests number of requests pending to be processed
+	PendingRequests int `json:"pendingRequests"`
+	// EndpointCount number of running pods
+	EndpointCount int `json:"endpointCount"`
+	// Requests number of requests processed since the previous stats
+	Requests int64 `json:"requests"`
+	// StatusClasses number of requests processed by status class since the previous stats
+	StatusClasses map[string]int64 `json:"statusClasses,omitempty"`
+	// ErrorRate ratio of requests with errors since the previous stats
+	ErrorRate float64 `json:"errorRate"`
+	// UpstreamResponseTime average response time (in seconds) of the endpoints since the previous stats
+	UpstreamResponseTime float64 `json:"upstreamResponseTime"`
+	// BackgroundRequests number of requests that are not activity since the previous stats
+	BackgroundRequests int64 `json:"backgroundRequests"`
+}
+
+// Proxy holds metrics
+type Proxy struct {
+	// WaitingForPods indicates if the proxy is holding requests waiting for pods to be avialable
+	WaitingForPods bool `json:"waitingForPods"`
+	// LastRequest seconds since the last request
+	LastRequest int `json:"lastRequest"`
+	// PendingRequests number of requests pending to be processed by the proxy
+	PendingRequests int `json:"pendingRequest"`
+	// EndpointCount number of running pods
+	EndpointCount int `json:"endpointCount"`
+	// EjectedEndpoints number of endpoints ejected by the passive health checks
+	EjectedEndpoints int `json:"ejectedEndpoints"`
+	// HeldRequests number of requests waiting for pods
+	HeldRequests int `json:"heldRequests"`
+	// ErrorRate ratio of requests with errors since the previous stats
+	ErrorRate float64 `json:"errorRate"`
+	// Targets stats of each backend
+	Targets []Target `json:"targets,omitempty"`
+}
+
+// time returns the time when the stats were collected
+func (s *Stats) time() time.Time {
+	sec, dec := math.Modf(s.Timestamp)
+	return time.Unix(int64(sec), int64(dec*1e9))
+}
+
+// requests returns the number of requests processed by all the backends
+func (s *Stats) requests() int64 {
+	var requests int64
+	for _, backend := range s.Backends {
+		requests += backend.Requests
+	}
+
+	return requests
+}
+
+func parseStats(data []byte) (*Stats, error) {
+	stats := &Stats{}
+	err := json.Unmarshal(data, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	if stats.Version != StatsVersion {
+		return nil, fmt.Errorf("unsupported stats version %v (expected %v)", stats.Version, StatsVersion)
+	}
+
+	return stats, nil
+}
+
+// aggregate returns the stats of all the backends of the proxy.
+// The previous stats (optional) are used to calculate rates.
+func aggregate(current, previous *Stats) *Proxy {
+	out := &Proxy{}
+
+	var lastRequest float64
+	var requests, errors int64
+	var endpoints int
+
+	for _, backend := range current.Backends {
+		out.HeldRequests += backend.HeldRequests
+		out.PendingRequests += backend.HeldRequests + backend.ActiveRequests
+		out.EjectedEndpoints += backend.EjectedEndpoints
+
+		if backend.Endpoints > endpoints {
+			endpoints = backend.Endpoints
+		}
+
+		if backend.LastRequest > lastRequest {
+			lastRequest = backend.LastRequest
+		}
+
+		requests += backend.Requests
+		errors += backend.Errors
+
+		out.Targets = append(out.Targets, aggregateTarget(&backend, previous.backend(backend.Name)))
+	}
+
+	out.WaitingForPods = out.HeldRequests > 0
+
+	// the backends of the ports of a service have the same pods. Documents
+	// without the unique addresses use the backend with more endpoints
+	out.EndpointCount = current.Endpoints
+	if out.EndpointCount == 0 {
+		out.EndpointCount = endpoints
+	}
+
+	if lastRequest > 0 && current.Timestamp > lastRequest {
+		out.LastRequest = int(current.Timestamp - lastRequest)
+	}
+
+	if previous != nil {
+		previousRequests := previous.requests()
+
+		var previousErrors int64
+		for _, backend := range previous.Backends {
+			previousErrors += backend.Errors
+		}
+
+		// counters are reset when NGINX restarts
+		if requests > previousRequests && errors >= previousErrors {
+			out.ErrorRate = float64(errors-previousErrors) / float64(requests-previousRequests)
+		}
+	}
+
+	return out
+}
+
+// backend returns the stats of a backend. Returns nil if the backend does not exist
+func (s *Stats) backend(name string) *Backend {
+	if s == nil {
+		return nil
+	}
+
+	for i := range s.Backends {
+		if s.Backends[i].Name == name {
+			return &s.Backends[i]
+		}
+	}
+
+	return nil
+}
+
+// aggregateTarget returns the stats of a backend.
+// The previous stats of the backend (optional) are used to calculate rates.
+func aggregateTarget(current, previous *Backend) Target {
+	out := Target{
+		Name:            current.Name,
+		HeldRequests:    current.HeldRequests,
+		PendingRequests: current.HeldRequests + current.ActiveRequests,
+		EndpointCount:   current.Endpoints,
+	}
+
+	if previous != nil && current.BackgroundRequests > previous.BackgroundRequests {
+		out.BackgroundRequests = current.BackgroundRequests - previous.BackgroundRequests
+	}
+
+	// counters are reset when NGINX restarts
+	if previous == nil || current.Requests <= previous.Requests || current.Errors < previous.Errors {
+		return out
+	}
+
+	out.Requests = current.Requests - previous.Requests
+	out.ErrorRate = float64(current.Errors-previous.Errors) / float64(out.Requests)
+
+	for class, count := range current.StatusClasses {
+		if diff := count - previous.StatusClasses[class]; diff > 0 {
+			if out.StatusClasses == nil {
+				out.StatusClasses = map[string]int64{}
+			}
+
+			out.StatusClasses[class] = diff
+		}
+	}
+
+	if upstreamRequests := current.UpstreamRequests - previous.UpstreamRequests; upstreamRequests > 0 {
+		out.UpstreamResponseTime = (current.UpstreamTime - previous.UpstreamTime) / float64(upstreamRequests)
+	}
+
+	return out
+}
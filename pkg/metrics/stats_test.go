@@ -0,0 +1,247 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testStatsParse(t testing.TB) {
+	var scenarios = []struct {
+		in       string
+		previous string
+		out      *Proxy
+		err      bool
+	}{
+		// 0: Invalid
+		{
+			in:  ``,
+			err: true,
+		},
+		// 1: Unsupported version
+		{
+			in:  `{"version": 2, "timestamp": 100, "backends": []}`,
+			err: true,
+		},
+		// 2: No backends
+		{
+			in:  `{"version": 1, "timestamp": 100, "backends": []}`,
+			out: &Proxy{},
+		},
+		// 3: Valid
+		{
+			in: `{
+  "version": 1,
+  "timestamp": 1000.5,
+  "backends": [
+    {
+      "name": "default-http-svc-8080",
+      "heldRequests": 0,
+      "activeRequests": 10,
+      "lastRequest": 989.5,
+      "endpoints": 2,
+      "ejectedEndpoints": 1,
+      "requests": 431,
+      "errors": 3
+    }
+  ]
+}`,
+			out: &Proxy{
+				LastRequest:      11,
+				PendingRequests:  10,
+				EndpointCount:    2,
+				EjectedEndpoints: 1,
+				Targets: []Target{
+					{Name: "default-http-svc-8080", PendingRequests: 10, EndpointCount: 2},
+				},
+			},
+		},
+		// 4: Waiting for pods in one backend
+		{
+			in: `{
+  "version": 1,
+  "timestamp": 1133,
+  "backends": [
+    {"name": "default-http-svc-8080", "heldRequests": 1, "activeRequests": 0, "lastRequest": 1000, "endpoints": 0, "ejectedEndpoints": 0, "requests": 4, "errors": 0},
+    {"name": "default-http-svc-8443", "heldRequests": 2, "activeRequests": 0, "lastRequest": 900, "endpoints": 0, "ejectedEndpoints": 0, "requests": 3, "errors": 0}
+  ]
+}`,
+			out: &Proxy{
+				WaitingForPods:  true,
+				LastRequest:     133,
+				PendingRequests: 3,
+				HeldRequests:    3,
+				Targets: []Target{
+					{Name: "default-http-svc-8080", HeldRequests: 1, PendingRequests: 1},
+					{Name: "default-http-svc-8443", HeldRequests: 2, PendingRequests: 2},
+				},
+			},
+		},
+		// 5: Error rate since the previous stats
+		{
+			in: `{
+  "version": 1,
+  "timestamp": 1006,
+  "backends": [
+    {"name": "default-http-svc-8080", "heldRequests": 0, "activeRequests": 1, "lastRequest": 1006, "endpoints": 1, "ejectedEndpoints": 0, "requests": 150, "errors": 15}
+  ]
+}`,
+			previous: `{
+  "version": 1,
+  "timestamp": 1000,
+  "backends": [
+    {"name": "default-http-svc-8080", "heldRequests": 0, "activeRequests": 1, "lastRequest": 1000, "endpoints": 1, "ejectedEndpoints": 0, "requests": 100, "errors": 10}
+  ]
+}`,
+			out: &Proxy{
+				PendingRequests: 1,
+				EndpointCount:   1,
+				ErrorRate:       0.1,
+				Targets: []Target{
+					{Name: "default-http-svc-8080", PendingRequests: 1, EndpointCount: 1, Requests: 50, ErrorRate: 0.1},
+				},
+			},
+		},
+		// 6: Counters reset after a restart of NGINX
+		{
+			in: `{
+  "version": 1,
+  "timestamp": 1006,
+  "backends": [
+    {"name": "default-http-svc-8080", "heldRequests": 0, "activeRequests": 0, "lastRequest": 1000, "endpoints": 1, "ejectedEndpoints": 0, "requests": 5, "errors": 5}
+  ]
+}`,
+			previous: `{
+  "version": 1,
+  "timestamp": 1000,
+  "backends": [
+    {"name": "default-http-svc-8080", "heldRequests": 0, "activeRequests": 0, "lastRequest": 1000, "endpoints": 1, "ejectedEndpoints": 0, "requests": 100, "errors": 10}
+  ]
+}`,
+			out: &Proxy{
+				LastRequest:   6,
+				EndpointCount: 1,
+				Targets: []Target{
+					{Name: "default-http-svc-8080", EndpointCount: 1},
+				},
+			},
+		},
+		// 7: Requests by status class and response time of the endpoints of each target
+		{
+			in: `{
+  "version": 1,
+  "timestamp": 1006,
+  "backends": [
+    {"name": "default-http-svc-8080", "heldRequests": 0, "activeRequests": 0, "lastRequest": 1006, "endpoints": 1, "ejectedEndpoints": 0, "requests": 110, "errors": 2,
+     "statusClasses": {"1xx": 0, "2xx": 100, "3xx": 0, "4xx": 8, "5xx": 2}, "upstreamTime": 13, "upstreamRequests": 110},
+    {"name": "default-http-svc-8443", "heldRequests": 0, "activeRequests": 0, "lastRequest": 900, "endpoints": 1, "ejectedEndpoints": 0, "requests": 0, "errors": 0}
+  ]
+}`,
+			previous: `{
+  "version": 1,
+  "timestamp": 1000,
+  "backends": [
+    {"name": "default-http-svc-8080", "heldRequests": 0, "activeRequests": 0, "lastRequest": 1000, "endpoints": 1, "ejectedEndpoints": 0, "requests": 100, "errors": 1,
+     "statusClasses": {"1xx": 0, "2xx": 95, "3xx": 0, "4xx": 4, "5xx": 1}, "upstreamTime": 10, "upstreamRequests": 100}
+  ]
+}`,
+			out: &Proxy{
+				EndpointCount: 1,
+				ErrorRate:     0.1,
+				Targets: []Target{
+					{
+						Name:                 "default-http-svc-8080",
+						EndpointCount:        1,
+						Requests:             10,
+						StatusClasses:        map[string]int64{"2xx": 5, "4xx": 4, "5xx": 1},
+						ErrorRate:            0.1,
+						UpstreamResponseTime: 0.3,
+					},
+					{Name: "default-http-svc-8443", EndpointCount: 1},
+				},
+			},
+		},
+		// 8: Background requests (i.e. probes) are not activity
+		{
+			in: `{
+  "version": 1,
+  "timestamp": 1060,
+  "backends": [
+    {"name": "default-http-svc-8080", "heldRequests": 0, "activeRequests": 0, "lastRequest": 1000, "endpoints": 1, "ejectedEndpoints": 0, "requests": 100, "errors": 0, "backgroundRequests": 26}
+  ]
+}`,
+			previous: `{
+  "version": 1,
+  "timestamp": 1000,
+  "backends": [
+    {"name": "default-http-svc-8080", "heldRequests": 0, "activeRequests": 0, "lastRequest": 1000, "endpoints": 1, "ejectedEndpoints": 0, "requests": 100, "errors": 0, "backgroundRequests": 20}
+  ]
+}`,
+			out: &Proxy{
+				LastRequest:   60,
+				EndpointCount: 1,
+				Targets: []Target{
+					{Name: "default-http-svc-8080", EndpointCount: 1, BackgroundRequests: 6},
+				},
+			},
+		},
+		// 9: The ports of a service have the same endpoints
+		{
+			in: `{
+  "version": 1,
+  "timestamp": 1000,
+  "endpoints": 2,
+  "backends": [
+    {"name": "default-http-svc-8080", "heldRequests": 0, "activeRequests": 0, "lastRequest": 1000, "endpoints": 2, "ejectedEndpoints": 0, "requests": 0, "errors": 0},
+    {"name": "default-http-svc-8443", "heldRequests": 0, "activeRequests": 0, "lastRequest": 1000, "endpoints": 2, "ejectedEndpoints": 0, "requests": 0, "errors": 0}
+  ]
+}`,
+			out: &Proxy{
+				EndpointCount: 2,
+				Targets: []Target{
+					{Name: "default-http-svc-8080", EndpointCount: 2},
+					{Name: "default-http-svc-8443", EndpointCount: 2},
+				},
+			},
+		},
+	}
+
+	for i, scenario := range scenarios {
+		stats, err := parseStats([]byte(scenario.in))
+		if scenario.err {
+			if err == nil {
+				t.Errorf("%d. expected an error", i)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%d. error: %s", i, err)
+			continue
+		}
+
+		var previous *Stats
+		if scenario.previous != "" {
+			previous, err = parseStats([]byte(scenario.previous))
+			if err != nil {
+				t.Errorf("%d. error: %s", i, err)
+				continue
+			}
+		}
+
+		out := aggregate(stats, previous)
+		if !reflect.DeepEqual(out, scenario.out) {
+			t.Errorf("%d. %+v is not equal to expected value %+v", i, out, scenario.out)
+			continue
+		}
+	}
+}
+
+func TestStatsParse(t *testing.T) {
+	testStatsParse(t)
+}
+
+func BenchmarkStatsParse(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		testStatsParse(b)
+	}
+}
@@ -41,6 +41,24 @@ func newPostStatusRequest(path, data interface{}) (int, []byte, error) {
 	return res.StatusCode, body, nil
 }
 
+// NewGetStatusRequest creates a new GET request to the internal NGINX status server
+func NewGetStatusRequest(path string) (int, []byte, error) {
+	url := fmt.Sprintf("http+unix://%v%v", statusLocation, path)
+
+	res, err := socketClient.Get(url)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return res.StatusCode, body, nil
+}
+
 func buildUnixSocketClient() *http.Client {
 	u := &httpunix.Transport{
 		DialTimeout:           1 * time.Second,
@@ -0,0 +1,37 @@
+package nginx
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	configPushes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "horus_nginx_config_pushes_total",
+			Help: "Number of dynamic configuration updates sent to NGINX by path and result",
+		},
+		[]string{"path", "result"},
+	)
+
+	reloads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "horus_nginx_reloads_total",
+			Help: "Number of NGINX reloads by result",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(configPushes, reloads)
+}
+
+// result returns the value of the result label for the error
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "success"
+}
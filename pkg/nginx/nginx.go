@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"sort"
+	"sync"
 	"syscall"
 	"time"
 
@@ -25,6 +27,28 @@ type NGINX interface {
 
 	// Update changes the running configuration in NGINX
 	Update(*Configuration) error
+
+	// RunningConfiguration returns the configuration used by NGINX
+	RunningConfiguration() *Configuration
+
+	// Pushes returns the last dynamic configuration update of each path
+	Pushes() []Push
+}
+
+// Push is a dynamic configuration update sent to NGINX
+type Push struct {
+	// Path of the status server that received the update
+	Path string `json:"path"`
+	// Time of the update
+	Time time.Time `json:"time"`
+	// Data sent to NGINX
+	Data interface{} `json:"data"`
+	// Acknowledged is true if NGINX accepted the update
+	Acknowledged bool `json:"acknowledged"`
+	// StatusCode of the last response of NGINX
+	StatusCode int `json:"statusCode,omitempty"`
+	// Error of the update
+	Error string `json:"error,omitempty"`
 }
 
 // NewInstance returns an NGINX instance
@@ -37,13 +61,18 @@ func NewInstance(path string) (NGINX, error) {
 	return &nginx{
 		template:             tpl,
 		runningConfiguration: &Configuration{},
+		pushes:               map[string]*Push{},
 	}, nil
 }
 
 type nginx struct {
 	template *template
 
+	mu sync.RWMutex
+
 	runningConfiguration *Configuration
+
+	pushes map[string]*Push
 }
 
 func (ngx *nginx) Start(stopCh <-chan struct{}) error {
@@ -95,24 +124,86 @@ func (ngx *nginx) Update(cfg *Configuration) error {
 		return err
 	}
 
-	if ngx.runningConfiguration.Equal(cfg) {
+	if ngx.RunningConfiguration().Equal(cfg) {
 		return nil
 	}
 
 	time.Sleep(2 * time.Second)
 
-	err = updateConfiguration(cfg.Servers)
+	err = ngx.push("/configuration/backends", cfg.Servers)
+	if err != nil {
+		return err
+	}
+
+	err = ngx.push("/configuration/general", cfg.General)
 	if err != nil {
 		return err
 	}
 
+	ngx.mu.Lock()
 	ngx.runningConfiguration = cfg
+	ngx.mu.Unlock()
 
 	log.V(2).Info("NGINX configuration", "cfg", cfg)
 
 	return nil
 }
 
+func (ngx *nginx) RunningConfiguration() *Configuration {
+	ngx.mu.RLock()
+	defer ngx.mu.RUnlock()
+
+	return ngx.runningConfiguration
+}
+
+func (ngx *nginx) Pushes() []Push {
+	ngx.mu.RLock()
+	defer ngx.mu.RUnlock()
+
+	pushes := make([]Push, 0, len(ngx.pushes))
+	for _, push := range ngx.pushes {
+		pushes = append(pushes, *push)
+	}
+
+	sort.Slice(pushes, func(i, j int) bool {
+		return pushes[i].Path < pushes[j].Path
+	})
+
+	return pushes
+}
+
+// push sends a dynamic configuration update to NGINX recording the result
+func (ngx *nginx) push(path string, data interface{}) error {
+	statusCode, err := updateConfiguration(path, data)
+
+	push := &Push{
+		Path:         path,
+		Time:         time.Now(),
+		Data:         data,
+		Acknowledged: err == nil,
+		StatusCode:   statusCode,
+	}
+
+	if err != nil {
+		push.Error = err.Error()
+	}
+
+	ngx.mu.Lock()
+	ngx.pushes[path] = push
+	ngx.mu.Unlock()
+
+	return err
+}
+
+// ReloadError is returned when NGINX fails to reload the configuration
+type ReloadError struct {
+	err error
+}
+
+func (e *ReloadError) Error() string {
+	return fmt.Sprintf("reloading NGINX: %v", e.err)
+}
+
 // Binary location of NGINX binary.
 var Binary = "/usr/local/openresty/nginx/sbin/nginx"
 
@@ -178,14 +269,17 @@ func reloadIfRequired(data []byte) error {
 	cmd.Stderr = os.Stderr
 
 	err = cmd.Run()
+	reloads.WithLabelValues(result(err)).Inc()
 	if err != nil {
-		return err
+		return &ReloadError{err}
 	}
 
 	return nil
 }
 
-func updateConfiguration(servers []Server) error {
+// updateConfiguration sends a dynamic configuration update to NGINX
+// returning the status code of the last response
+func updateConfiguration(path string, data interface{}) (int, error) {
 	retry := wait.Backoff{
 		Steps:    15,
 		Duration: 1 * time.Second,
@@ -193,8 +287,10 @@ func updateConfiguration(servers []Server) error {
 		Jitter:   0.1,
 	}
 
+	var statusCode int
 	err := wait.ExponentialBackoff(retry, func() (bool, error) {
-		statusCode, _, err := newPostStatusRequest("/configuration/backends", servers)
+		var err error
+		statusCode, _, err = newPostStatusRequest(path, data)
 		if err != nil {
 			return false, err
 		}
@@ -206,5 +302,7 @@ func updateConfiguration(servers []Server) error {
 		return true, nil
 	})
 
-	return err
+	configPushes.WithLabelValues(path, result(err)).Inc()
+
+	return statusCode, err
 }
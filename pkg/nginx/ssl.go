@@ -0,0 +1,61 @@
+package nginx
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// SSLDirectory defines the location where the certificates are stored
+var SSLDirectory = "/etc/nginx/ssl"
+
+// SSLCert describes a PEM file used by NGINX
+type SSLCert struct {
+	// Path of the PEM file
+	Path string `json:"path"`
+	// Checksum SHA1 of the content of the file. It is rendered in the
+	// template to reload NGINX when the content changes
+	Checksum string `json:"checksum"`
+}
+
+// Equal compares the certificate with another one
+func (c *SSLCert) Equal(to *SSLCert) bool {
+	if c == nil || to == nil {
+		return c == to
+	}
+
+	return c.Path == to.Path && c.Checksum == to.Checksum
+}
+
+// WriteSSLCert stores the concatenation of the PEM blocks in a file
+// located in the SSLDirectory. The file is only written if the content changed.
+func WriteSSLCert(name string, pems ...[]byte) (*SSLCert, error) {
+	data := bytes.Join(pems, []byte("\n"))
+
+	err := os.MkdirAll(SSLDirectory, 0700)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating directory %v", SSLDirectory)
+	}
+
+	path := filepath.Join(SSLDirectory, name+".pem")
+
+	current, err := ioutil.ReadFile(path)
+	if err != nil || !bytes.Equal(current, data) {
+		err = ioutil.WriteFile(path, data, 0600)
+		if err != nil {
+			return nil, errors.Wrapf(err, "writing certificate %v", path)
+		}
+	}
+
+	checksum := sha1.Sum(data)
+
+	return &SSLCert{
+		Path:     path,
+		Checksum: hex.EncodeToString(checksum[:]),
+	}, nil
+}
@@ -11,11 +11,73 @@ func (e *Endpoint) Equal(to *Endpoint) bool {
 	return e.Address == to.Address && e.Port == to.Port
 }
 
+// SessionAffinity defines how requests from the same client are bound to an endpoint
+type SessionAffinity struct {
+	// Type of affinity. Only ClientIP is supported. Empty means no affinity
+	Type string `json:"type,omitempty"`
+	// TimeoutSeconds time after the last request a client remains bound to the same endpoint
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// Equal compares the session affinity with another one
+func (s *SessionAffinity) Equal(to *SessionAffinity) bool {
+	return s.Type == to.Type && s.TimeoutSeconds == to.TimeoutSeconds
+}
+
+// Upstream schemes supported by the proxy
+const (
+	SchemeHTTP  = "http"
+	SchemeHTTPS = "https"
+	SchemeGRPCS = "grpcs"
+)
+
+// UpstreamTLS defines the TLS connection to the endpoints
+type UpstreamTLS struct {
+	// CACertificate used to verify the certificates of the endpoints.
+	// Without a CA the certificates are not verified
+	CACertificate *SSLCert `json:"caCertificate,omitempty"`
+	// ClientCertificate presented to the endpoints (mutual TLS)
+	ClientCertificate *SSLCert `json:"clientCertificate,omitempty"`
+	// ServerName used in SNI and to verify the certificates of the endpoints
+	ServerName string `json:"serverName,omitempty"`
+	// VerifyDepth maximum depth of the chain of the certificates of the endpoints
+	VerifyDepth int `json:"verifyDepth,omitempty"`
+}
+
+// Equal compares the upstream TLS with another one
+func (u *UpstreamTLS) Equal(to *UpstreamTLS) bool {
+	if !u.CACertificate.Equal(to.CACertificate) {
+		return false
+	}
+
+	if !u.ClientCertificate.Equal(to.ClientCertificate) {
+		return false
+	}
+
+	return u.ServerName == to.ServerName && u.VerifyDepth == to.VerifyDepth
+}
+
 // Server defines an NGINX server section
 type Server struct {
-	Name      string     `json:"name,omitempty"`
-	Port      string     `json:"port,omitempty"`
-	Endpoints []Endpoint `json:"endpoints"`
+	Name            string          `json:"name,omitempty"`
+	Port            string          `json:"port,omitempty"`
+	SessionAffinity SessionAffinity `json:"sessionAffinity"`
+	Endpoints       []Endpoint      `json:"endpoints"`
+
+	// Scheme used to connect to the endpoints (http, https or grpcs)
+	Scheme string `json:"scheme,omitempty"`
+	// UpstreamTLS defines the connection to the endpoints when the scheme is https or grpcs
+	UpstreamTLS UpstreamTLS `json:"upstreamTLS"`
+}
+
+// GRPC returns true if the endpoints use gRPC
+func (e Server) GRPC() bool {
+	return e.Scheme == SchemeGRPCS
+}
+
+// TLS returns true if the connection to the endpoints uses TLS
+func (e Server) TLS() bool {
+	return e.Scheme == SchemeHTTPS || e.Scheme == SchemeGRPCS
 }
 
 var compareEndpointsFunc = func(e1, e2 interface{}) bool {
@@ -46,6 +108,18 @@ func (e *Server) Equal(to *Server) bool {
 		return false
 	}
 
+	if !(&e.SessionAffinity).Equal(&to.SessionAffinity) {
+		return false
+	}
+
+	if e.Scheme != to.Scheme {
+		return false
+	}
+
+	if !(&e.UpstreamTLS).Equal(&to.UpstreamTLS) {
+		return false
+	}
+
 	return compareEndpoints(e.Endpoints, to.Endpoints)
 }
 
@@ -67,13 +141,169 @@ func compareServers(a, b []Server) bool {
 	return Compare(a, b, compareServerFunc)
 }
 
+// OutlierDetection defines the passive health checking of endpoints.
+// Endpoints failing consecutive requests are ejected from the balancer
+// and do not receive traffic until the ejection time expires.
+type OutlierDetection struct {
+	// ConsecutiveFailures number of consecutive failures (connection errors or 5xx) before
+	// ejecting an endpoint. Zero disables the ejection of endpoints
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// EjectionSeconds number of seconds an ejected endpoint does not receive traffic
+	EjectionSeconds int `json:"ejectionSeconds"`
+	// MaxEjectionPercent maximum percentage of endpoints of a server that can be ejected
+	MaxEjectionPercent int `json:"maxEjectionPercent"`
+	// Retries number of additional endpoints to try after a failure
+	Retries int `json:"retries"`
+}
+
+// Equal compares the outlier detection with another one
+func (o *OutlierDetection) Equal(to *OutlierDetection) bool {
+	return *o == *to
+}
+
+// SlowStart defines how requests held while there are no endpoints are released
+// once the deployment is scaled from zero, to avoid sending all of them at once
+// to a pod that just started.
+type SlowStart struct {
+	// WindowSeconds maximum number of seconds, after the first endpoint is available,
+	// held requests are kept waiting for the minimum ready endpoints or paced.
+	// Once the window expires, all the held requests are released.
+	WindowSeconds int `json:"windowSeconds"`
+	// MinReadyEndpoints number of endpoints required before releasing held requests.
+	// Only enforced during the window
+	MinReadyEndpoints int `json:"minReadyEndpoints"`
+	// ReleaseRate maximum number of held requests released per second. Zero means no limit
+	ReleaseRate int `json:"releaseRate"`
+}
+
+// Equal compares the slow start with another one
+func (s *SlowStart) Equal(to *SlowStart) bool {
+	return *s == *to
+}
+
+// Forwarded defines how the identity of the client is sent to the endpoints
+type Forwarded struct {
+	// Enabled sets the X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host,
+	// X-Forwarded-Port, X-Real-IP and Forwarded headers
+	Enabled bool `json:"enabled"`
+	// TrustedCIDRs addresses of the proxies and load balancers in front of the proxy.
+	// The forwarded headers sent by these addresses are preserved
+	TrustedCIDRs []string `json:"trustedCIDRs"`
+	// UseProxyProtocol enables the PROXY protocol in the listeners
+	UseProxyProtocol bool `json:"useProxyProtocol"`
+}
+
+// Equal compares the forwarded settings with another one
+func (f *Forwarded) Equal(to *Forwarded) bool {
+	if f.Enabled != to.Enabled {
+		return false
+	}
+
+	if f.UseProxyProtocol != to.UseProxyProtocol {
+		return false
+	}
+
+	return Compare(f.TrustedCIDRs, to.TrustedCIDRs, compareStringsFunc)
+}
+
+var compareStringsFunc = func(e1, e2 interface{}) bool {
+	return e1.(string) == e2.(string)
+}
+
+// Tracing defines how the spans of the requests are recorded.
+// Trace context (traceparent) and request IDs are always propagated
+type Tracing struct {
+	// Enabled records the spans of the sampled requests
+	Enabled bool `json:"enabled"`
+	// SampleRatio ratio of new traces sampled (0 to 1). Incoming traces keep their sampling decision
+	SampleRatio float64 `json:"sampleRatio"`
+}
+
+// Equal compares the tracing settings with another one
+func (t *Tracing) Equal(to *Tracing) bool {
+	return *t == *to
+}
+
+// Background defines the requests that are not activity of the deployment, i.e. probes
+// and monitoring. A request is background if it matches any of the rules
+type Background struct {
+	// Paths prefixes of the path of the requests
+	Paths []string `json:"paths"`
+	// UserAgents substrings of the User-Agent header of the requests (i.e. kube-probe)
+	UserAgents []string `json:"userAgents"`
+	// CIDRs addresses of the clients (IPv4 only)
+	CIDRs []string `json:"cidrs"`
+	// Headers names of headers present in the requests, or name=value to match the value
+	Headers []string `json:"headers"`
+	// Wake allows background requests to wake the deployment.
+	// Otherwise they receive a 503 while there are no endpoints
+	Wake bool `json:"wake"`
+}
+
+// Equal compares the background settings with another one
+func (b *Background) Equal(to *Background) bool {
+	if b.Wake != to.Wake {
+		return false
+	}
+
+	if !Compare(b.Paths, to.Paths, compareStringsFunc) {
+		return false
+	}
+
+	if !Compare(b.UserAgents, to.UserAgents, compareStringsFunc) {
+		return false
+	}
+
+	if !Compare(b.CIDRs, to.CIDRs, compareStringsFunc) {
+		return false
+	}
+
+	return Compare(b.Headers, to.Headers, compareStringsFunc)
+}
+
+// General defines settings of the proxy not related to a particular server
+type General struct {
+	OutlierDetection OutlierDetection `json:"outlierDetection"`
+	SlowStart        SlowStart        `json:"slowStart"`
+	Forwarded        Forwarded        `json:"forwarded"`
+	Tracing          Tracing          `json:"tracing"`
+	Background       Background       `json:"background"`
+}
+
+// Equal compares the general settings with another one
+func (g *General) Equal(to *General) bool {
+	if !(&g.OutlierDetection).Equal(&to.OutlierDetection) {
+		return false
+	}
+
+	if !(&g.SlowStart).Equal(&to.SlowStart) {
+		return false
+	}
+
+	if !(&g.Forwarded).Equal(&to.Forwarded) {
+		return false
+	}
+
+	if !(&g.Tracing).Equal(&to.Tracing) {
+		return false
+	}
+
+	return (&g.Background).Equal(&to.Background)
+}
+
 // Configuration defines an NGINX configuration
 type Configuration struct {
 	// Servers server sections
 	Servers []Server `json:"servers"`
+	// General settings shared by all the servers
+	General General `json:"general"`
 }
 
 // Equal tests for equality between two Server types
 func (c *Configuration) Equal(to *Configuration) bool {
+	if !(&c.General).Equal(&to.General) {
+		return false
+	}
+
 	return compareServers(c.Servers, to.Servers)
 }
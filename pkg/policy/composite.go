@@ -0,0 +1,66 @@
+package policy
+
+import (
+	"strings"
+)
+
+// CompositeName name of the composite policy
+const CompositeName = "composite"
+
+// Composite combines the decisions of several policies.
+// Forced decisions take precedence over the rest, Wake over Sleep
+// (using the highest number of replicas) and Sleep over None.
+type Composite struct {
+	Policies []Policy
+}
+
+// NewComposite returns a policy combining the decisions of policies
+func NewComposite(policies ...Policy) *Composite {
+	return &Composite{
+		Policies: policies,
+	}
+}
+
+// Name returns the name of the policy
+func (p *Composite) Name() string {
+	names := make([]string, 0, len(p.Policies))
+	for _, policy := range p.Policies {
+		names = append(names, policy.Name())
+	}
+
+	return CompositeName + "(" + strings.Join(names, ",") + ")"
+}
+
+// Decide returns the decision with the highest precedence
+func (p *Composite) Decide(snapshot *Snapshot, target *Target, clock Clock) Decision {
+	result := none()
+
+	for _, policy := range p.Policies {
+		decision := policy.Decide(snapshot, target, clock)
+		if decision.Policy == "" {
+			decision.Policy = policy.Name()
+		}
+
+		if result.Force && !decision.Force {
+			continue
+		}
+
+		if decision.Force && !result.Force {
+			result = decision
+			continue
+		}
+
+		switch decision.Action {
+		case Wake:
+			if result.Action != Wake || decision.Replicas > result.Replicas {
+				result = decision
+			}
+		case Sleep:
+			if result.Action == None {
+				result = decision
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,179 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var months = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var weekdayNumbers = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// Cron is a cron expression with the fields minute, hour, day of the month,
+// month and day of the week. Fields accept *, lists (1,2), ranges (1-5),
+// steps (*/15) and names of months and days of the week (Jan, Mon).
+type Cron struct {
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+
+	// restricted fields of the days. If both are restricted a
+	// time matches if any of them matches (like cron)
+	anyDay     bool
+	anyWeekday bool
+
+	expression string
+}
+
+// ParseCron returns the Cron of a cron expression (i.e. "0 9 * * Mon-Fri")
+func ParseCron(expression string) (*Cron, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q (expected minute hour day month weekday)", expression)
+	}
+
+	c := &Cron{
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+		expression: strings.Join(fields, " "),
+	}
+
+	var err error
+	if c.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+
+	if c.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+
+	if c.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+
+	if c.months, err = parseCronField(fields[3], 1, 12, months); err != nil {
+		return nil, err
+	}
+
+	if c.weekdays, err = parseCronField(fields[4], 0, 7, weekdayNumbers); err != nil {
+		return nil, err
+	}
+
+	// 7 is also Sunday
+	if c.weekdays[7] {
+		c.weekdays[0] = true
+	}
+
+	return c, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (map[int]bool, error) {
+	values := map[int]bool{}
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in cron field %q", field)
+			}
+
+			part = part[:i]
+		}
+
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			start, err = parseCronValue(bounds[0], min, max, names)
+			if err != nil {
+				return nil, err
+			}
+
+			end = start
+			if len(bounds) == 2 {
+				end, err = parseCronValue(bounds[1], min, max, names)
+				if err != nil {
+					return nil, err
+				}
+			} else if step > 1 {
+				// 5/15 means from 5 to the maximum every 15
+				end = max
+			}
+
+			if end < start {
+				return nil, fmt.Errorf("invalid range in cron field %q", field)
+			}
+		}
+
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+
+	return values, nil
+}
+
+func parseCronValue(value string, min, max int, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("invalid cron value %q (valid: %v-%v)", value, min, max)
+	}
+
+	return n, nil
+}
+
+// Matches returns true if the minute of a time matches the expression
+func (c *Cron) Matches(t time.Time) bool {
+	if !c.minutes[t.Minute()] || !c.hours[t.Hour()] || !c.months[int(t.Month())] {
+		return false
+	}
+
+	day := c.days[t.Day()]
+	weekday := c.weekdays[int(t.Weekday())]
+
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// Last returns the latest time not after t matching the expression, looking
+// back at most limit. Returns false if there is no match in that period.
+func (c *Cron) Last(t time.Time, limit time.Duration) (time.Time, bool) {
+	t = t.Truncate(time.Minute)
+
+	for earliest := t.Add(-limit); !t.Before(earliest); t = t.Add(-time.Minute) {
+		if c.Matches(t) {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// String returns the cron expression
+func (c *Cron) String() string {
+	return c.expression
+}
@@ -0,0 +1,39 @@
+package policy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+)
+
+// LastRequestName name of the last request policy
+const LastRequestName = "last-request"
+
+func init() {
+	Register(LastRequestName, func(config *env.Spec) (Policy, error) {
+		return &LastRequest{IdleAfter: *config.IdleAfter}, nil
+	})
+}
+
+// LastRequest puts the deployment to sleep when there are no requests after a period of time
+type LastRequest struct {
+	IdleAfter time.Duration
+}
+
+// Name returns the name of the policy
+func (p *LastRequest) Name() string {
+	return LastRequestName
+}
+
+// Decide returns Sleep if the last request is older than IdleAfter
+func (p *LastRequest) Decide(snapshot *Snapshot, target *Target, clock Clock) Decision {
+	if snapshot.Stats.LastRequest < int(p.IdleAfter.Seconds()) {
+		return none()
+	}
+
+	return Decision{
+		Action: Sleep,
+		Reason: fmt.Sprintf("no requests in the last %v", p.IdleAfter),
+	}
+}
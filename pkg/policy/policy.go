@@ -0,0 +1,151 @@
+// Package policy contains the policies used to decide when a deployment
+// should be scaled to zero (sleep) or from zero (wake).
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+)
+
+// Action defines the change in the deployment requested by a policy
+type Action string
+
+const (
+	// None keeps the deployment as is
+	None Action = "None"
+	// Wake scales the deployment to at least the replicas of the decision
+	Wake Action = "Wake"
+	// Sleep scales the deployment to zero
+	Sleep Action = "Sleep"
+)
+
+// Decision is the result of the evaluation of a policy
+type Decision struct {
+	// Action to execute
+	Action Action `json:"action"`
+	// Replicas minimum number of replicas when the action is Wake
+	Replicas int32 `json:"replicas,omitempty"`
+	// Reason human readable explanation of the decision
+	Reason string `json:"reason,omitempty"`
+	// Policy name of the policy that took the decision
+	Policy string `json:"policy,omitempty"`
+	// Force the action over the decisions of other policies and the held requests
+	Force bool `json:"force,omitempty"`
+}
+
+// History returns the requests processed by the proxy in a period of time
+type History interface {
+	Window(duration time.Duration) *metrics.Window
+}
+
+// Snapshot contains the stats collected from the proxy
+type Snapshot struct {
+	Stats   *metrics.Proxy
+	History History
+	// Profile histogram of the requests by day of the week and hour of the day
+	Profile *metrics.Profile
+}
+
+// Target describes the deployment handled by the proxy
+type Target struct {
+	Namespace  string
+	Deployment string
+	// ReadyEndpoints number of pods receiving traffic
+	ReadyEndpoints int
+}
+
+// Clock returns the current time
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is a Clock that returns the system time
+type RealClock struct{}
+
+// Now returns the current system time
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// Policy decides if a deployment should sleep or wake
+type Policy interface {
+	// Name returns the name of the policy
+	Name() string
+	// Decide returns the action to execute in the target
+	Decide(snapshot *Snapshot, target *Target, clock Clock) Decision
+}
+
+// Factory creates a new policy using the configuration of the proxy
+type Factory func(config *env.Spec) (Policy, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register makes a policy available by name.
+// Register panics if it is called twice with the same name.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("policy %v is already registered", name))
+	}
+
+	factories[name] = factory
+}
+
+// Names returns the names of the registered policies
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// New returns the policy defined in the configuration.
+// More than one policy is combined using a composite policy.
+func New(config *env.Spec) (Policy, error) {
+	if len(config.Policies) == 0 {
+		return nil, fmt.Errorf("at least one policy is required (valid: %v)", Names())
+	}
+
+	policies := make([]Policy, 0, len(config.Policies))
+	for _, name := range config.Policies {
+		factoriesMu.RLock()
+		factory, ok := factories[name]
+		factoriesMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("invalid policy %v (valid: %v)", name, Names())
+		}
+
+		p, err := factory(config)
+		if err != nil {
+			return nil, fmt.Errorf("creating policy %v: %v", name, err)
+		}
+
+		policies = append(policies, p)
+	}
+
+	if len(policies) == 1 {
+		return policies[0], nil
+	}
+
+	return NewComposite(policies...), nil
+}
+
+func none() Decision {
+	return Decision{Action: None}
+}
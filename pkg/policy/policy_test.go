@@ -0,0 +1,272 @@
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+type fixedPolicy Decision
+
+func (p fixedPolicy) Name() string {
+	return p.Policy
+}
+
+func (p fixedPolicy) Decide(snapshot *Snapshot, target *Target, clock Clock) Decision {
+	return Decision(p)
+}
+
+func TestSchedule(t *testing.T) {
+	var scenarios = []struct {
+		period string
+		days   []string
+		now    string
+		awake  bool
+	}{
+		// 0: During the period
+		{period: "09:00-18:00", days: []string{"Mon"}, now: "2019-06-24T10:00:00Z", awake: true},
+		// 1: End of the period is excluded
+		{period: "09:00-18:00", days: []string{"Mon"}, now: "2019-06-24T18:00:00Z", awake: false},
+		// 2: Day of the week not included
+		{period: "09:00-18:00", days: []string{"Tue"}, now: "2019-06-24T10:00:00Z", awake: false},
+		// 3: Period ending the next day, before midnight
+		{period: "22:00-06:00", days: []string{"Mon"}, now: "2019-06-24T23:00:00Z", awake: true},
+		// 4: Period ending the next day, after midnight
+		{period: "22:00-06:00", days: []string{"Mon"}, now: "2019-06-25T05:00:00Z", awake: true},
+		// 5: Period ending the next day, started the day before not included
+		{period: "22:00-06:00", days: []string{"Tue"}, now: "2019-06-25T05:00:00Z", awake: false},
+	}
+
+	for i, scenario := range scenarios {
+		s, err := NewSchedule(scenario.period, scenario.days, "UTC", 2)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", i, err)
+		}
+
+		now, err := time.Parse(time.RFC3339, scenario.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decision := s.Decide(&Snapshot{}, &Target{}, fixedClock(now))
+		if (decision.Action == Wake) != scenario.awake {
+			t.Errorf("%v: expected awake %v but got %v", i, scenario.awake, decision.Action)
+		}
+
+		if scenario.awake && decision.Replicas != 2 {
+			t.Errorf("%v: expected 2 replicas but got %v", i, decision.Replicas)
+		}
+	}
+}
+
+func TestComposite(t *testing.T) {
+	var scenarios = []struct {
+		decisions []Decision
+		out       Decision
+	}{
+		// 0: No decisions
+		{
+			decisions: []Decision{},
+			out:       Decision{Action: None},
+		},
+		// 1: Sleep wins over None
+		{
+			decisions: []Decision{{Action: None, Policy: "a"}, {Action: Sleep, Policy: "b"}},
+			out:       Decision{Action: Sleep, Policy: "b"},
+		},
+		// 2: Wake wins over Sleep
+		{
+			decisions: []Decision{{Action: Sleep, Policy: "a"}, {Action: Wake, Replicas: 1, Policy: "b"}},
+			out:       Decision{Action: Wake, Replicas: 1, Policy: "b"},
+		},
+		// 3: Highest number of replicas wins
+		{
+			decisions: []Decision{{Action: Wake, Replicas: 3, Policy: "a"}, {Action: Wake, Replicas: 1, Policy: "b"}},
+			out:       Decision{Action: Wake, Replicas: 3, Policy: "a"},
+		},
+		// 4: Forced Sleep wins over Wake
+		{
+			decisions: []Decision{{Action: Wake, Replicas: 3, Policy: "a"}, {Action: Sleep, Force: true, Policy: "b"}, {Action: Wake, Replicas: 1, Policy: "c"}},
+			out:       Decision{Action: Sleep, Force: true, Policy: "b"},
+		},
+	}
+
+	for i, scenario := range scenarios {
+		policies := []Policy{}
+		for _, decision := range scenario.decisions {
+			policies = append(policies, fixedPolicy(decision))
+		}
+
+		out := NewComposite(policies...).Decide(&Snapshot{}, &Target{}, RealClock{})
+		if out != scenario.out {
+			t.Errorf("%v: expected %+v but got %+v", i, scenario.out, out)
+		}
+	}
+}
+
+func TestCron(t *testing.T) {
+	var scenarios = []struct {
+		expression string
+		now        string
+		matches    bool
+		err        bool
+	}{
+		// 0: Every minute
+		{expression: "* * * * *", now: "2019-06-24T10:07:00Z", matches: true},
+		// 1: Days of the week by name
+		{expression: "0 9 * * Mon-Fri", now: "2019-06-24T09:00:00Z", matches: true},
+		// 2: Weekend excluded
+		{expression: "0 9 * * Mon-Fri", now: "2019-06-23T09:00:00Z", matches: false},
+		// 3: Steps
+		{expression: "*/15 * * * *", now: "2019-06-24T10:45:00Z", matches: true},
+		// 4: Steps not matching
+		{expression: "*/15 * * * *", now: "2019-06-24T10:46:00Z", matches: false},
+		// 5: Lists and months by name
+		{expression: "30 8,20 1 Jun,Jul *", now: "2019-07-01T20:30:00Z", matches: true},
+		// 6: Day of the month or day of the week
+		{expression: "0 0 1 * Mon", now: "2019-06-24T00:00:00Z", matches: true},
+		// 7: Sunday as 7
+		{expression: "0 0 * * 7", now: "2019-06-23T00:00:00Z", matches: true},
+		// 8: Invalid number of fields
+		{expression: "0 9 * *", err: true},
+		// 9: Invalid value
+		{expression: "0 25 * * *", err: true},
+		// 10: Invalid range
+		{expression: "0 9 * * Fri-Mon", err: true},
+	}
+
+	for i, scenario := range scenarios {
+		c, err := ParseCron(scenario.expression)
+		if scenario.err {
+			if err == nil {
+				t.Errorf("%v: expected an error", i)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", i, err)
+		}
+
+		now, err := time.Parse(time.RFC3339, scenario.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Matches(now) != scenario.matches {
+			t.Errorf("%v: expected matches %v for %v", i, scenario.matches, now)
+		}
+	}
+}
+
+func TestWindows(t *testing.T) {
+	windows := "awake:2 0 9 * * Mon-Fri 9h; sleep 0 22 * * * 11h"
+
+	var scenarios = []struct {
+		now      string
+		action   Action
+		replicas int32
+		force    bool
+	}{
+		// 0: Inside the keep awake window
+		{now: "2019-06-24T10:00:00+02:00", action: Wake, replicas: 2},
+		// 1: End of the keep awake window is excluded
+		{now: "2019-06-24T18:00:00+02:00", action: None},
+		// 2: Inside the sleep window, after midnight
+		{now: "2019-06-25T03:00:00+02:00", action: Sleep, force: true},
+		// 3: Pre-warming before the keep awake window takes precedence over the sleep window
+		{now: "2019-06-25T08:50:00+02:00", action: Wake, replicas: 2},
+		// 4: Before the pre-warming lead time
+		{now: "2019-06-25T08:40:00+02:00", action: Sleep, force: true},
+		// 5: No keep awake window during the weekend
+		{now: "2019-06-23T10:00:00+02:00", action: None},
+		// 6: Timezone of the windows
+		{now: "2019-06-24T08:30:00Z", action: Wake, replicas: 2},
+	}
+
+	p, err := NewWindows(windows, "Europe/Berlin", 15*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, scenario := range scenarios {
+		now, err := time.Parse(time.RFC3339, scenario.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decision := p.Decide(&Snapshot{}, &Target{}, fixedClock(now))
+		if decision.Action != scenario.action || decision.Replicas != scenario.replicas || decision.Force != scenario.force {
+			t.Errorf("%v: expected %v (replicas %v, force %v) but got %+v", i, scenario.action, scenario.replicas, scenario.force, decision)
+		}
+	}
+
+	for _, invalid := range []string{"", "wake 0 9 * * * 1h", "awake:0 0 9 * * * 1h", "sleep:1 0 9 * * * 1h", "awake 0 9 * * * 10s"} {
+		if _, err := NewWindows(invalid, "UTC", 0); err == nil {
+			t.Errorf("expected an error for windows %q", invalid)
+		}
+	}
+}
+
+func TestPredictive(t *testing.T) {
+	profile := &metrics.Profile{}
+	// Monday 09:00 UTC had requests in 3 of 4 weeks
+	profile.Slots[time.Monday][9] = metrics.Slot{Observed: 4, Active: 3, Requests: 40}
+	// Monday 10:00 UTC had requests in 1 of 4 weeks
+	profile.Slots[time.Monday][10] = metrics.Slot{Observed: 4, Active: 1, Requests: 1}
+	// Monday 11:00 UTC was observed only once
+	profile.Slots[time.Monday][11] = metrics.Slot{Observed: 1, Active: 1, Requests: 10}
+
+	p := &Predictive{Lead: 10 * time.Minute, Confidence: 0.7, MinObservations: 2}
+
+	var scenarios = []struct {
+		now   string
+		awake bool
+	}{
+		// 0: Before an usually busy hour
+		{now: "2019-06-24T08:55:00Z", awake: true},
+		// 1: Before the lead time
+		{now: "2019-06-24T08:45:00Z", awake: false},
+		// 2: Hour without enough confidence
+		{now: "2019-06-24T09:55:00Z", awake: false},
+		// 3: Hour without enough observations
+		{now: "2019-06-24T10:55:00Z", awake: false},
+		// 4: Same time of another day of the week
+		{now: "2019-06-25T08:55:00Z", awake: false},
+	}
+
+	for i, scenario := range scenarios {
+		now, err := time.Parse(time.RFC3339, scenario.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decision := p.Decide(&Snapshot{Profile: profile}, &Target{}, fixedClock(now))
+		if (decision.Action == Wake) != scenario.awake {
+			t.Errorf("%v: expected awake %v but got %+v", i, scenario.awake, decision)
+		}
+	}
+
+	// the profile survives a restart of the proxy
+	data, err := json.Marshal(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &metrics.Profile{}
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Slots[time.Monday][9] != profile.Slots[time.Monday][9] {
+		t.Errorf("expected %+v but got %+v", profile.Slots[time.Monday][9], restored.Slots[time.Monday][9])
+	}
+}
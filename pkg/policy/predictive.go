@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+)
+
+// PredictiveName name of the predictive policy
+const PredictiveName = "predictive"
+
+func init() {
+	Register(PredictiveName, func(config *env.Spec) (Policy, error) {
+		return &Predictive{
+			Lead:            config.PredictiveLead,
+			Confidence:      config.PredictiveConfidence,
+			MinObservations: config.PredictiveMinWeeks,
+		}, nil
+	})
+}
+
+// Predictive wakes the deployment before the hours of the week that
+// historically had requests, to avoid the cold start of the first request
+type Predictive struct {
+	// Lead time before the busy hour the deployment is woken
+	Lead time.Duration
+	// Confidence minimum ratio of the observations of the hour with requests
+	Confidence float64
+	// MinObservations minimum number of times the hour was observed (one per week)
+	MinObservations int
+}
+
+// Name returns the name of the policy
+func (p *Predictive) Name() string {
+	return PredictiveName
+}
+
+// Decide returns Wake if the hour after the lead time is usually busy and None otherwise
+func (p *Predictive) Decide(snapshot *Snapshot, target *Target, clock Clock) Decision {
+	if snapshot.Profile == nil {
+		return none()
+	}
+
+	at := clock.Now().Add(p.Lead)
+
+	slot := snapshot.Profile.Slot(at)
+	if slot.Observed < p.MinObservations || slot.Observed == 0 || slot.Confidence() < p.Confidence {
+		return none()
+	}
+
+	return Decision{
+		Action:   Wake,
+		Replicas: 1,
+		Reason: fmt.Sprintf("usually busy on %v at %02d:00 UTC (confidence %.2f over %v weeks)",
+			at.UTC().Weekday(), at.UTC().Hour(), slot.Confidence(), slot.Observed),
+	}
+}
@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+)
+
+// RateWindowName name of the rate window policy
+const RateWindowName = "rate-window"
+
+func init() {
+	Register(RateWindowName, func(config *env.Spec) (Policy, error) {
+		if config.IdleMaxRequests <= 0 && config.IdleMaxRate <= 0 {
+			return nil, fmt.Errorf("IDLE_MAX_REQUESTS or IDLE_MAX_RATE is required")
+		}
+
+		return &RateWindow{
+			Window:      config.IdleWindow,
+			MaxRequests: config.IdleMaxRequests,
+			MaxRate:     config.IdleMaxRate,
+		}, nil
+	})
+}
+
+// RateWindow puts the deployment to sleep when the number of requests
+// or the rate of requests in a period of time are below a threshold
+type RateWindow struct {
+	Window time.Duration
+	// MaxRequests the deployment sleeps with fewer requests in the window. Zero disables the check
+	MaxRequests int64
+	// MaxRate the deployment sleeps with less requests per second in the window. Zero disables the check
+	MaxRate float64
+}
+
+// Name returns the name of the policy
+func (p *RateWindow) Name() string {
+	return RateWindowName
+}
+
+// Decide returns Sleep if the requests in the window are below the thresholds
+func (p *RateWindow) Decide(snapshot *Snapshot, target *Target, clock Clock) Decision {
+	w := snapshot.History.Window(p.Window)
+	if !w.Complete {
+		// not enough stats to take a decision
+		return none()
+	}
+
+	if p.MaxRequests > 0 && w.Requests < p.MaxRequests {
+		return Decision{
+			Action: Sleep,
+			Reason: fmt.Sprintf("%v requests in the last %v (threshold %v)", w.Requests, p.Window, p.MaxRequests),
+		}
+	}
+
+	if p.MaxRate > 0 && w.Rate < p.MaxRate {
+		return Decision{
+			Action: Sleep,
+			Reason: fmt.Sprintf("%.3f requests per second in the last %v (threshold %v)", w.Rate, p.Window, p.MaxRate),
+		}
+	}
+
+	return none()
+}
@@ -0,0 +1,138 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+)
+
+// ScheduleName name of the schedule policy
+const ScheduleName = "schedule"
+
+func init() {
+	Register(ScheduleName, func(config *env.Spec) (Policy, error) {
+		return NewSchedule(config.ScheduleAwake, config.ScheduleDays, config.ScheduleTimezone, config.ScheduleMinReplicas)
+	})
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Schedule keeps the deployment awake during a period of time of the day
+type Schedule struct {
+	// Start of the period as the time since midnight
+	Start time.Duration
+	// End of the period as the time since midnight. If End is before Start the period ends the next day
+	End time.Duration
+	// Days of the week the period starts
+	Days map[time.Weekday]bool
+	// Location used to evaluate the period
+	Location *time.Location
+	// MinReplicas minimum number of replicas during the period
+	MinReplicas int32
+
+	period string
+}
+
+// NewSchedule returns a schedule policy for a period in the format HH:MM-HH:MM,
+// days of the week (i.e. Mon, Tue) and a timezone (i.e. Europe/Berlin)
+func NewSchedule(period string, days []string, timezone string, minReplicas int32) (*Schedule, error) {
+	parts := strings.Split(period, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid period %q (expected HH:MM-HH:MM)", period)
+	}
+
+	start, err := parseTimeOfDay(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseTimeOfDay(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %v: %v", timezone, err)
+	}
+
+	s := &Schedule{
+		Start:       start,
+		End:         end,
+		Days:        map[time.Weekday]bool{},
+		Location:    location,
+		MinReplicas: minReplicas,
+		period:      period,
+	}
+
+	for _, day := range days {
+		weekday, ok := weekdays[strings.ToLower(strings.TrimSpace(day))]
+		if !ok {
+			return nil, fmt.Errorf("invalid day of the week %q", day)
+		}
+
+		s.Days[weekday] = true
+	}
+
+	if s.MinReplicas < 1 {
+		s.MinReplicas = 1
+	}
+
+	return s, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of the day %q (expected HH:MM)", value)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Name returns the name of the policy
+func (p *Schedule) Name() string {
+	return ScheduleName
+}
+
+// Decide returns Wake during the period and None outside of it
+func (p *Schedule) Decide(snapshot *Snapshot, target *Target, clock Clock) Decision {
+	if !p.contains(clock.Now()) {
+		return none()
+	}
+
+	return Decision{
+		Action:   Wake,
+		Replicas: p.MinReplicas,
+		Reason:   fmt.Sprintf("keep awake during %v (%v)", p.period, p.Location),
+	}
+}
+
+func (p *Schedule) contains(now time.Time) bool {
+	now = now.In(p.Location)
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, p.Location)
+	sinceMidnight := now.Sub(midnight)
+
+	if p.Start < p.End {
+		return p.Days[now.Weekday()] && sinceMidnight >= p.Start && sinceMidnight < p.End
+	}
+
+	// the period ends the next day
+	if sinceMidnight >= p.Start {
+		return p.Days[now.Weekday()]
+	}
+
+	yesterday := (now.Weekday() + 6) % 7
+	return p.Days[yesterday] && sinceMidnight < p.End
+}
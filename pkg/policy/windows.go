@@ -0,0 +1,192 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+)
+
+// WindowsName name of the schedule windows policy
+const WindowsName = "windows"
+
+func init() {
+	Register(WindowsName, func(config *env.Spec) (Policy, error) {
+		return NewWindows(config.ScheduleWindows, config.ScheduleTimezone, config.SchedulePrewarm)
+	})
+}
+
+// Window is a period of time, starting when a cron expression matches,
+// that keeps the deployment awake or forces it to sleep
+type Window struct {
+	// Action of the window. Wake keeps the deployment awake and Sleep forces it to sleep
+	Action Action
+	// Replicas minimum number of replicas of a Wake window
+	Replicas int32
+	// Start of the window
+	Start *Cron
+	// Duration of the window
+	Duration time.Duration
+
+	definition string
+}
+
+// ParseWindow returns the window defined as <action> <cron expression> <duration>.
+// The action is awake (one replica), awake:<replicas> or sleep.
+// i.e. "awake:2 0 9 * * Mon-Fri 9h" or "sleep 0 22 * * * 10h"
+func ParseWindow(definition string) (*Window, error) {
+	fields := strings.Fields(definition)
+	if len(fields) != 7 {
+		return nil, fmt.Errorf("invalid window %q (expected <action> <cron expression> <duration>)", definition)
+	}
+
+	w := &Window{
+		Replicas:   1,
+		definition: strings.Join(fields, " "),
+	}
+
+	action := strings.SplitN(fields[0], ":", 2)
+	switch action[0] {
+	case "awake":
+		w.Action = Wake
+		if len(action) == 2 {
+			replicas, err := strconv.Atoi(action[1])
+			if err != nil || replicas < 1 {
+				return nil, fmt.Errorf("invalid replicas in window %q", definition)
+			}
+
+			w.Replicas = int32(replicas)
+		}
+	case "sleep":
+		if len(action) == 2 {
+			return nil, fmt.Errorf("invalid action in window %q (sleep does not accept replicas)", definition)
+		}
+
+		w.Action = Sleep
+		w.Replicas = 0
+	default:
+		return nil, fmt.Errorf("invalid action %q in window %q (valid: awake, awake:<replicas> and sleep)", fields[0], definition)
+	}
+
+	var err error
+	w.Start, err = ParseCron(strings.Join(fields[1:6], " "))
+	if err != nil {
+		return nil, err
+	}
+
+	w.Duration, err = time.ParseDuration(fields[6])
+	if err != nil || w.Duration < time.Minute {
+		return nil, fmt.Errorf("invalid duration %q in window %q (minimum 1m)", fields[6], definition)
+	}
+
+	return w, nil
+}
+
+// Contains returns true if the time is inside the window. The end of the window is excluded
+func (w *Window) Contains(t time.Time) bool {
+	start, ok := w.Start.Last(t, w.Duration)
+	return ok && t.Before(start.Add(w.Duration))
+}
+
+// String returns the definition of the window
+func (w *Window) String() string {
+	return w.definition
+}
+
+// Windows keeps the deployment awake or forces it to sleep during windows of time.
+// Keep awake windows, including the pre-warming lead time, take precedence over sleep windows.
+type Windows struct {
+	Windows []*Window
+	// Location used to evaluate the windows
+	Location *time.Location
+	// Prewarm time before a keep awake window the deployment is woken
+	Prewarm time.Duration
+}
+
+// NewWindows returns a schedule windows policy for windows separated by ';',
+// a timezone (i.e. Europe/Berlin) and the pre-warming lead time
+func NewWindows(definitions string, timezone string, prewarm time.Duration) (*Windows, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %v: %v", timezone, err)
+	}
+
+	if prewarm < 0 {
+		return nil, fmt.Errorf("invalid pre-warming time %v", prewarm)
+	}
+
+	p := &Windows{
+		Location: location,
+		Prewarm:  prewarm,
+	}
+
+	for _, definition := range strings.Split(definitions, ";") {
+		if strings.TrimSpace(definition) == "" {
+			continue
+		}
+
+		w, err := ParseWindow(definition)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Windows = append(p.Windows, w)
+	}
+
+	if len(p.Windows) == 0 {
+		return nil, fmt.Errorf("SCHEDULE_WINDOWS is required")
+	}
+
+	return p, nil
+}
+
+// Name returns the name of the policy
+func (p *Windows) Name() string {
+	return WindowsName
+}
+
+// Decide returns Wake inside (or right before) a keep awake window, a forced
+// Sleep inside a sleep window and None outside of the windows
+func (p *Windows) Decide(snapshot *Snapshot, target *Target, clock Clock) Decision {
+	now := clock.Now().In(p.Location)
+
+	result := none()
+	for _, w := range p.Windows {
+		if w.Action != Wake || w.Replicas <= result.Replicas {
+			continue
+		}
+
+		switch {
+		case w.Contains(now):
+			result = Decision{
+				Action:   Wake,
+				Replicas: w.Replicas,
+				Reason:   fmt.Sprintf("keep awake during window %q (%v)", w, p.Location),
+			}
+		case p.Prewarm > 0 && w.Contains(now.Add(p.Prewarm)):
+			result = Decision{
+				Action:   Wake,
+				Replicas: w.Replicas,
+				Reason:   fmt.Sprintf("pre-warming %v before window %q (%v)", p.Prewarm, w, p.Location),
+			}
+		}
+	}
+
+	if result.Action == Wake {
+		return result
+	}
+
+	for _, w := range p.Windows {
+		if w.Action == Sleep && w.Contains(now) {
+			return Decision{
+				Action: Sleep,
+				Force:  true,
+				Reason: fmt.Sprintf("forced sleep during window %q (%v)", w, p.Location),
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,119 @@
+package scaler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/policy"
+)
+
+// DemandPolicy name used in the decisions of the demands
+const DemandPolicy = "demand"
+
+// DemandAnnotation annotation of the deployment requesting to wake (wake[:<duration>[:<replicas>]])
+// or to sleep (sleep) the deployment. The annotation is removed once the demand is accepted
+const DemandAnnotation = "horus-proxy/demand"
+
+// DefaultDemandDuration time a deployment woken on demand is kept awake
+const DefaultDemandDuration = 10 * time.Minute
+
+// Demand is an explicit request to wake or sleep the deployment, i.e. from a CI job
+type Demand struct {
+	// Action Wake or Sleep
+	Action policy.Action
+	// Replicas minimum number of replicas of a wake
+	Replicas int32
+	// Until time the deployment is kept awake. Not used by Sleep, kept until the deployment is asleep
+	Until time.Time
+	// Source of the demand, i.e. api
+	Source string
+}
+
+// RejectedDemandError is returned when an override prevents applying a demand
+type RejectedDemandError struct {
+	// Reason the demand was rejected
+	Reason string
+}
+
+func (e *RejectedDemandError) Error() string {
+	return fmt.Sprintf("demand rejected: %v", e.Reason)
+}
+
+// ParseDemand returns the demand defined in the value of the DemandAnnotation
+func ParseDemand(value string, now time.Time) (*Demand, error) {
+	parts := strings.SplitN(value, ":", 3)
+
+	switch parts[0] {
+	case "wake":
+		duration := DefaultDemandDuration
+		if len(parts) > 1 {
+			d, err := time.ParseDuration(parts[1])
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid duration of the demand %q", value)
+			}
+
+			duration = d
+		}
+
+		replicas := int64(1)
+		if len(parts) > 2 {
+			n, err := strconv.ParseInt(parts[2], 10, 32)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid replicas of the demand %q", value)
+			}
+
+			replicas = n
+		}
+
+		return &Demand{Action: policy.Wake, Replicas: int32(replicas), Until: now.Add(duration), Source: "annotation"}, nil
+	case "sleep":
+		if len(parts) > 1 {
+			return nil, fmt.Errorf("invalid demand %q (sleep does not accept a duration)", value)
+		}
+
+		return &Demand{Action: policy.Sleep, Source: "annotation"}, nil
+	}
+
+	return nil, fmt.Errorf("invalid demand %q (valid: wake, wake:<duration>, wake:<duration>:<replicas> and sleep)", value)
+}
+
+// Annotation returns the value of the DemandAnnotation requesting the demand
+func (d *Demand) Annotation(now time.Time) string {
+	if d.Action == policy.Sleep {
+		return "sleep"
+	}
+
+	return fmt.Sprintf("wake:%v:%v", d.Until.Sub(now).Round(time.Second), d.Replicas)
+}
+
+// pending returns true if the demand must be applied at a time
+func (d *Demand) pending(now time.Time) bool {
+	return d != nil && (d.Action == policy.Sleep || now.Before(d.Until))
+}
+
+// applied returns true if a sleep demand was applied by the step
+func (d *Demand) applied(r *Result) bool {
+	return d.Action == policy.Sleep && ((r.Scaled() && r.Direction == Down) || r.Stats.EndpointCount == 0)
+}
+
+// decision returns the decision replacing the one of the policies.
+// A sleep on demand is not stabilized
+func (d *Demand) decision() policy.Decision {
+	if d.Action == policy.Sleep {
+		return policy.Decision{
+			Action: policy.Sleep,
+			Force:  true,
+			Reason: fmt.Sprintf("sleep requested (%v)", d.Source),
+			Policy: DemandPolicy,
+		}
+	}
+
+	return policy.Decision{
+		Action:   policy.Wake,
+		Replicas: d.Replicas,
+		Reason:   fmt.Sprintf("wake requested until %v (%v)", d.Until.Format(time.RFC3339), d.Source),
+		Policy:   DemandPolicy,
+	}
+}
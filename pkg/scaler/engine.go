@@ -0,0 +1,497 @@
+// Package scaler contains the engine that changes the replicas of the
+// deployment using the stats of the proxy and the decisions of the policies.
+// The engine does not access NGINX or Kubernetes directly, which allows
+// to run it with a fake clock, a fake scale client and synthetic stats.
+package scaler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+	"github.com/aledbf/horus-proxy/pkg/policy"
+)
+
+const (
+	// Up direction of a scale operation that increases the replicas
+	Up = "up"
+	// Down direction of a scale operation that removes all the replicas
+	Down = "down"
+
+	// HeldRequestsPolicy name used in the decisions to wake the deployment due held requests
+	HeldRequestsPolicy = "held-requests"
+
+	// maxDecisions number of decisions kept by the engine
+	maxDecisions = 100
+)
+
+// Source returns the stats of the proxy
+type Source interface {
+	CurrentStats() *metrics.Proxy
+	policy.History
+	// Profile returns the histogram of the requests by day of the week and hour of the day
+	Profile() *metrics.Profile
+}
+
+// Client changes the replicas of the deployment
+type Client interface {
+	// Scale changes the replicas of the deployment. Scaling up sets the
+	// minimum number of replicas. Returns nil if no change was required.
+	Scale(replicas int32) (*appsv1.Deployment, error)
+}
+
+// Result describes an evaluation of the engine
+type Result struct {
+	// Time of the evaluation
+	Time time.Time
+	// Stats used in the evaluation
+	Stats *metrics.Proxy
+	// Decision taken in the evaluation
+	Decision policy.Decision
+	// Direction of the scale operation. Empty if the deployment was not scaled
+	Direction string
+	// Replicas requested in the scale operation
+	Replicas int32
+	// Deployment changed by the scale operation. Nil if no change was required
+	Deployment *appsv1.Deployment
+	// Duration of the scale operation
+	Duration time.Duration
+	// Err error of the scale operation
+	Err error
+	// ColdStart time since the first request was held without endpoints until the
+	// first endpoint was ready. Only set in the evaluation that sees the first endpoint
+	ColdStart time.Duration
+	// HeldWait time since the proxy started to hold requests until it stopped holding them.
+	// Only set when the proxy stops holding requests
+	HeldWait time.Duration
+	// AvoidedColdStart is true when the proxy processed the first requests after
+	// the deployment was woken from zero by a policy, without holding requests
+	AvoidedColdStart bool
+}
+
+// Scaled returns true if the replicas of the deployment changed
+func (r *Result) Scaled() bool {
+	return r.Direction != "" && r.Deployment != nil && r.Err == nil
+}
+
+// Activation sizes the scale from zero due held requests
+type Activation struct {
+	// TargetConcurrency number of held requests each replica is expected to absorb.
+	// Zero wakes the deployment with one replica
+	TargetConcurrency int
+	// MaxReplicas maximum number of replicas of the activation. Zero means no limit
+	MaxReplicas int32
+}
+
+// NewActivation returns the sizing of the scale from zero defined in the configuration
+func NewActivation(config *env.Spec) Activation {
+	return Activation{
+		TargetConcurrency: config.ActivationTargetConcurrency,
+		MaxReplicas:       config.ActivationMaxReplicas,
+	}
+}
+
+// Replicas returns the number of replicas required to absorb the held requests
+func (a Activation) Replicas(held int) int32 {
+	replicas := int32(1)
+	if a.TargetConcurrency > 0 && held > a.TargetConcurrency {
+		replicas = int32((held + a.TargetConcurrency - 1) / a.TargetConcurrency)
+	}
+
+	if a.MaxReplicas > 0 && replicas > a.MaxReplicas {
+		replicas = a.MaxReplicas
+	}
+
+	return replicas
+}
+
+// DecisionRecord is a decision of the engine kept for introspection
+type DecisionRecord struct {
+	Time time.Time `json:"time"`
+	policy.Decision
+	// Direction of the scale operation. Empty if the deployment was not scaled
+	Direction string `json:"direction,omitempty"`
+	// Scaled is true if the replicas of the deployment changed
+	Scaled bool `json:"scaled"`
+	// Error of the scale operation
+	Error string `json:"error,omitempty"`
+	// Stats used to take the decision
+	Stats *metrics.Proxy `json:"stats"`
+}
+
+// Engine evaluates the stats of the proxy and scales the deployment
+type Engine struct {
+	policy policy.Policy
+	source Source
+	client Client
+	clock  policy.Clock
+	target *policy.Target
+
+	activation Activation
+
+	stabilizer *stabilizer
+
+	// activity of the other replicas of the proxy
+	peers Peers
+
+	// override of the decisions of the policies
+	override Override
+	// explicit request to wake or sleep the deployment
+	demand *Demand
+
+	// time the proxy started to hold requests
+	holdingSince *time.Time
+	// time the oldest held request started to wait, reported before the evaluation
+	heldSince *time.Time
+	// time the first request was held while the deployment did not have endpoints
+	coldStartSince *time.Time
+
+	// the deployment was woken from zero by a policy and did not process requests yet
+	prewarmed bool
+
+	mu        sync.RWMutex
+	decisions []DecisionRecord
+	status    Status
+}
+
+// NewEngine returns an engine that scales the deployment using the decisions of a policy
+func NewEngine(p policy.Policy, source Source, client Client, clock policy.Clock, namespace, deployment string) *Engine {
+	return &Engine{
+		policy: p,
+		source: source,
+		client: client,
+		clock:  clock,
+		target: &policy.Target{
+			Namespace:  namespace,
+			Deployment: deployment,
+		},
+		stabilizer: &stabilizer{},
+	}
+}
+
+// SetActivation defines how the scale from zero due held requests is sized
+func (e *Engine) SetActivation(a Activation) {
+	e.activation = a
+}
+
+// SetStabilization defines how the engine prevents the deployment from
+// sleeping right after waking and from oscillating
+func (e *Engine) SetStabilization(s Stabilization) {
+	e.stabilizer.Stabilization = s
+}
+
+// SetPeers defines the source of the activity of the other replicas of the proxy.
+// The deployment sleeps only when all the replicas are idle
+func (e *Engine) SetPeers(p Peers) {
+	e.peers = p
+}
+
+// SetHeldSince records the time the oldest request held by the proxy started to wait.
+// Cold starts are measured from it instead of the first evaluation that sees held requests
+func (e *Engine) SetHeldSince(t time.Time) {
+	e.heldSince = &t
+}
+
+// SetOverride replaces the decisions of the policies, i.e. to pause the scaling during an incident
+func (e *Engine) SetOverride(o Override) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.override = o
+}
+
+// Demand requests to wake or sleep the deployment, replacing the decisions of the policies and
+// the previous demand. A wake keeps the deployment awake until the time of the demand and a sleep
+// is kept until the deployment is asleep. Returns a RejectedDemandError if an override prevents it
+func (e *Engine) Demand(d Demand) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	err := e.override.Rejects(d, e.clock.Now())
+	if err != nil {
+		return err
+	}
+
+	e.demand = &d
+
+	return nil
+}
+
+// Step evaluates the current stats and scales the deployment if required.
+// Requests held by any replica of the proxy wake the deployment unless it is forced to sleep.
+func (e *Engine) Step() *Result {
+	r := e.step()
+	e.record(r)
+
+	e.mu.Lock()
+	e.status = e.stabilizer.status(e.clock.Now())
+	if override := e.override.active(e.clock.Now()); override != (Override{}) {
+		e.status.Override = &override
+	}
+	e.mu.Unlock()
+
+	return r
+}
+
+// Status returns the stabilization of the deployment after the last evaluation
+func (e *Engine) Status() Status {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.status
+}
+
+// Decisions returns the latest decisions that scaled the deployment, failed
+// or changed the action of the previous one, from the oldest to the newest
+func (e *Engine) Decisions() []DecisionRecord {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	decisions := make([]DecisionRecord, len(e.decisions))
+	copy(decisions, e.decisions)
+
+	return decisions
+}
+
+// record keeps the result of an evaluation if the deployment was scaled,
+// the scale operation failed or the decision is different from the previous one
+func (e *Engine) record(r *Result) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	changed := len(e.decisions) == 0
+	if !changed {
+		last := e.decisions[len(e.decisions)-1]
+		changed = last.Action != r.Decision.Action || last.Policy != r.Decision.Policy
+	}
+
+	if !changed && !r.Scaled() && r.Err == nil {
+		return
+	}
+
+	decision := DecisionRecord{
+		Time:      r.Time,
+		Decision:  r.Decision,
+		Direction: r.Direction,
+		Scaled:    r.Scaled(),
+		Stats:     r.Stats,
+	}
+
+	if r.Err != nil {
+		decision.Error = r.Err.Error()
+	}
+
+	e.decisions = append(e.decisions, decision)
+	if len(e.decisions) > maxDecisions {
+		e.decisions = e.decisions[len(e.decisions)-maxDecisions:]
+	}
+}
+
+func (e *Engine) step() *Result {
+	now := e.clock.Now()
+	stats := e.source.CurrentStats()
+
+	r := &Result{
+		Time:  now,
+		Stats: stats,
+	}
+
+	decision := e.decide(stats)
+
+	e.mu.Lock()
+	override := e.override
+	demand := e.demand
+	// expired demands and demands superseded by an override are removed
+	if demand != nil && (!demand.pending(now) || override.Rejects(*demand, now) != nil) {
+		e.demand = nil
+		demand = nil
+	}
+	e.mu.Unlock()
+
+	if o, ok := override.decide(now); ok {
+		decision = o
+	} else if demand.pending(now) {
+		decision = demand.decision()
+	}
+
+	decision = override.pause(decision)
+
+	forcedSleep := decision.Action == policy.Sleep && decision.Force
+
+	if stats.WaitingForPods {
+		// requests were held after the deployment was woken
+		e.prewarmed = false
+	} else if e.prewarmed && processedRequests(stats) {
+		r.AvoidedColdStart = true
+		e.prewarmed = false
+	}
+
+	// the cold start goes from the first request held without endpoints to the first ready endpoint
+	if stats.WaitingForPods && stats.EndpointCount == 0 && e.coldStartSince == nil {
+		start := now
+		if e.heldSince != nil && e.heldSince.Before(now) {
+			start = *e.heldSince
+		}
+
+		e.coldStartSince = &start
+	}
+
+	if e.coldStartSince != nil && stats.EndpointCount > 0 {
+		r.ColdStart = now.Sub(*e.coldStartSince)
+		e.coldStartSince = nil
+	}
+
+	e.heldSince = nil
+
+	// requests held during a forced sleep keep waiting
+	if e.holdingSince != nil && !stats.WaitingForPods {
+		r.HeldWait = now.Sub(*e.holdingSince)
+		e.holdingSince = nil
+	}
+
+	// replicas of the proxy that are not the leader only report the requests they hold
+	peerHeld := heldPeerRequests(e.peers)
+
+	if (stats.WaitingForPods || peerHeld > 0) && !forcedSleep {
+		if stats.WaitingForPods && e.holdingSince == nil {
+			e.holdingSince = &now
+		}
+
+		held := stats.HeldRequests + peerHeld
+		replicas := e.activation.Replicas(held)
+
+		r.Decision = policy.Decision{
+			Action:   policy.Wake,
+			Replicas: replicas,
+			Reason:   "pending requests",
+			Policy:   HeldRequestsPolicy,
+		}
+
+		if e.activation.TargetConcurrency > 0 {
+			r.Decision.Reason = fmt.Sprintf("%v held requests (target concurrency %v)", held, e.activation.TargetConcurrency)
+		}
+
+		if peerHeld > 0 {
+			r.Decision.Reason = fmt.Sprintf("%v (%v in other proxy replicas)", r.Decision.Reason, peerHeld)
+		}
+
+		e.scale(r, Up, replicas)
+
+		return r
+	}
+
+	r.Decision = decision
+
+	if r.Decision.Action != policy.Sleep {
+		e.stabilizer.awake()
+	}
+
+	switch r.Decision.Action {
+	case policy.Wake:
+		// avoid access to apiserver running unnecessary scaling action
+		if stats.EndpointCount < int(r.Decision.Replicas) {
+			e.scale(r, Up, r.Decision.Replicas)
+			if r.Scaled() && stats.EndpointCount == 0 {
+				e.prewarmed = true
+			}
+		}
+	case policy.Sleep:
+		// avoid access to apiserver running unnecessary scaling action
+		// and never remove the pods processing requests
+		if stats.EndpointCount > 0 && stats.PendingRequests-stats.HeldRequests == 0 {
+			// forced decisions are not stabilized
+			if postponed := e.stabilizer.canSleep(now); postponed != "" && !r.Decision.Force {
+				r.Decision.Reason = fmt.Sprintf("%v (postponed: %v)", r.Decision.Reason, postponed)
+				break
+			}
+
+			// other replicas of the proxy could be receiving the requests
+			if busy := busyPeers(e.peers); busy != "" && !r.Decision.Force {
+				r.Decision.Reason = fmt.Sprintf("%v (postponed: %v)", r.Decision.Reason, busy)
+				break
+			}
+
+			e.scale(r, Down, 0)
+			if r.Scaled() {
+				e.prewarmed = false
+			}
+		}
+	}
+
+	if demand != nil && demand.applied(r) {
+		e.mu.Lock()
+		// the demand could be replaced during the step
+		if e.demand == demand {
+			e.demand = nil
+		}
+		e.mu.Unlock()
+	}
+
+	return r
+}
+
+// Observe evaluates the policies with the current stats without scaling the
+// deployment, i.e. in a replica of the proxy that is not the leader
+func (e *Engine) Observe() *Result {
+	stats := e.source.CurrentStats()
+
+	return &Result{
+		Time:     e.clock.Now(),
+		Stats:    stats,
+		Decision: e.decide(stats),
+	}
+}
+
+// decide returns the decision of the policies for the stats
+func (e *Engine) decide(stats *metrics.Proxy) policy.Decision {
+	e.target.ReadyEndpoints = stats.EndpointCount
+
+	snapshot := &policy.Snapshot{
+		Stats:   stats,
+		History: e.source,
+		Profile: e.source.Profile(),
+	}
+
+	decision := e.policy.Decide(snapshot, e.target, e.clock)
+	if decision.Policy == "" {
+		decision.Policy = e.policy.Name()
+	}
+
+	return decision
+}
+
+func (e *Engine) scale(r *Result, direction string, replicas int32) {
+	start := e.clock.Now()
+
+	r.Direction = direction
+	r.Replicas = replicas
+	r.Deployment, r.Err = e.client.Scale(replicas)
+	r.Duration = e.clock.Now().Sub(start)
+
+	if !r.Scaled() {
+		return
+	}
+
+	switch {
+	case direction == Down:
+		e.stabilizer.slept()
+	case r.Stats.EndpointCount == 0:
+		// activation of the deployment
+		e.stabilizer.woke(start)
+	}
+}
+
+// processedRequests returns true if the proxy processed requests since the previous stats
+func processedRequests(stats *metrics.Proxy) bool {
+	for _, target := range stats.Targets {
+		if target.Requests > 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,752 @@
+package scaler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+	"github.com/aledbf/horus-proxy/pkg/policy"
+)
+
+type fakeSource struct {
+	stats  *metrics.Proxy
+	window *metrics.Window
+}
+
+func (s *fakeSource) CurrentStats() *metrics.Proxy {
+	return s.stats
+}
+
+func (s *fakeSource) Profile() *metrics.Profile {
+	return &metrics.Profile{}
+}
+
+func (s *fakeSource) Window(duration time.Duration) *metrics.Window {
+	if s.window == nil {
+		return &metrics.Window{Duration: duration}
+	}
+
+	return s.window
+}
+
+func TestEngineStep(t *testing.T) {
+	var scenarios = []struct {
+		policy    policy.Policy
+		replicas  int32
+		stats     *metrics.Proxy
+		window    *metrics.Window
+		direction string
+		calls     []int32
+	}{
+		// 0: Held requests wake the deployment
+		{
+			policy:    &policy.LastRequest{IdleAfter: time.Minute},
+			replicas:  0,
+			stats:     &metrics.Proxy{WaitingForPods: true, HeldRequests: 1, PendingRequests: 1},
+			direction: Up,
+			calls:     []int32{1},
+		},
+		// 1: Idle deployment sleeps
+		{
+			policy:    &policy.LastRequest{IdleAfter: time.Minute},
+			replicas:  1,
+			stats:     &metrics.Proxy{LastRequest: 120, EndpointCount: 1},
+			direction: Down,
+			calls:     []int32{0},
+		},
+		// 2: Pods processing requests are not removed
+		{
+			policy:    &policy.LastRequest{IdleAfter: time.Minute},
+			replicas:  1,
+			stats:     &metrics.Proxy{LastRequest: 120, EndpointCount: 1, PendingRequests: 1},
+			direction: "",
+		},
+		// 3: Deployment already scaled to zero
+		{
+			policy:    &policy.LastRequest{IdleAfter: time.Minute},
+			replicas:  0,
+			stats:     &metrics.Proxy{LastRequest: 120},
+			direction: "",
+		},
+		// 4: Active deployment
+		{
+			policy:    &policy.LastRequest{IdleAfter: time.Minute},
+			replicas:  1,
+			stats:     &metrics.Proxy{LastRequest: 10, EndpointCount: 1},
+			direction: "",
+		},
+		// 5: Low rate of requests
+		{
+			policy:    &policy.RateWindow{Window: time.Minute, MaxRequests: 10},
+			replicas:  1,
+			stats:     &metrics.Proxy{EndpointCount: 1},
+			window:    &metrics.Window{Duration: time.Minute, Requests: 2, Complete: true},
+			direction: Down,
+			calls:     []int32{0},
+		},
+		// 6: Policies waking the deployment
+		{
+			policy:    &fixedPolicy{Action: policy.Wake, Replicas: 2},
+			replicas:  0,
+			stats:     &metrics.Proxy{},
+			direction: Up,
+			calls:     []int32{2},
+		},
+		// 7: Scaling up never reduces the replicas
+		{
+			policy:    &fixedPolicy{Action: policy.Wake, Replicas: 2},
+			replicas:  3,
+			stats:     &metrics.Proxy{EndpointCount: 1},
+			direction: Up,
+		},
+		// 8: Forced sleep does not wake the deployment due held requests
+		{
+			policy:    &fixedPolicy{Action: policy.Sleep, Force: true},
+			replicas:  0,
+			stats:     &metrics.Proxy{WaitingForPods: true, HeldRequests: 1, PendingRequests: 1},
+			direction: "",
+		},
+		// 9: Forced sleep waits for the requests being processed
+		{
+			policy:    &fixedPolicy{Action: policy.Sleep, Force: true},
+			replicas:  1,
+			stats:     &metrics.Proxy{LastRequest: 1, EndpointCount: 1, PendingRequests: 1},
+			direction: "",
+		},
+		// 10: Forced sleep ignores recent requests
+		{
+			policy:    &fixedPolicy{Action: policy.Sleep, Force: true},
+			replicas:  1,
+			stats:     &metrics.Proxy{LastRequest: 1, EndpointCount: 1},
+			direction: Down,
+			calls:     []int32{0},
+		},
+	}
+
+	for i, scenario := range scenarios {
+		clock := NewFakeClock(time.Unix(1000, 0))
+		client := NewFakeClient(clock, scenario.replicas, 0)
+		source := &fakeSource{stats: scenario.stats, window: scenario.window}
+
+		engine := NewEngine(scenario.policy, source, client, clock, "default", "test")
+
+		r := engine.Step()
+		if r.Err != nil {
+			t.Errorf("%v: unexpected error: %v", i, r.Err)
+		}
+
+		if r.Direction != scenario.direction {
+			t.Errorf("%v: expected direction %q but got %q", i, scenario.direction, r.Direction)
+		}
+
+		if !reflect.DeepEqual(client.Calls, scenario.calls) {
+			t.Errorf("%v: expected calls %v but got %v", i, scenario.calls, client.Calls)
+		}
+	}
+}
+
+func TestEngineColdStart(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	client := NewFakeClient(clock, 0, 0)
+	source := &fakeSource{stats: &metrics.Proxy{WaitingForPods: true, HeldRequests: 1, PendingRequests: 1}}
+
+	engine := NewEngine(&policy.LastRequest{IdleAfter: time.Minute}, source, client, clock, "default", "test")
+
+	// the first request was held before the evaluation
+	engine.SetHeldSince(clock.Now().Add(-3 * time.Second))
+
+	r := engine.Step()
+	if !r.Scaled() || r.Decision.Policy != HeldRequestsPolicy {
+		t.Fatalf("expected a scale up due held requests but got %+v", r)
+	}
+
+	if r.ColdStart != 0 {
+		t.Errorf("expected no cold start before the first endpoint is ready but got %v", r.ColdStart)
+	}
+
+	clock.Step(10 * time.Second)
+	r = engine.Step()
+	if r.Scaled() || r.ColdStart != 0 {
+		t.Errorf("unexpected scale operation or cold start %+v", r)
+	}
+
+	clock.Step(5 * time.Second)
+	source.stats = &metrics.Proxy{EndpointCount: 1, PendingRequests: 1}
+
+	r = engine.Step()
+	if r.HeldWait != 15*time.Second {
+		t.Errorf("expected held wait of 15s but got %v", r.HeldWait)
+	}
+
+	if r.ColdStart != 18*time.Second {
+		t.Errorf("expected cold start of 18s but got %v", r.ColdStart)
+	}
+
+	clock.Step(5 * time.Second)
+	if r = engine.Step(); r.ColdStart != 0 {
+		t.Errorf("expected a single cold start but got %v", r.ColdStart)
+	}
+}
+
+func TestEngineAvoidedColdStart(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	client := NewFakeClient(clock, 0, 0)
+	source := &fakeSource{stats: &metrics.Proxy{}}
+
+	engine := NewEngine(&fixedPolicy{Action: policy.Wake, Replicas: 1}, source, client, clock, "default", "test")
+
+	r := engine.Step()
+	if !r.Scaled() || r.Direction != Up {
+		t.Fatalf("expected a scale up but got %+v", r)
+	}
+
+	clock.Step(5 * time.Second)
+	source.stats = &metrics.Proxy{EndpointCount: 1}
+	if r := engine.Step(); r.AvoidedColdStart {
+		t.Errorf("unexpected avoided cold start without requests")
+	}
+
+	clock.Step(5 * time.Second)
+	source.stats = &metrics.Proxy{EndpointCount: 1, Targets: []metrics.Target{{Name: "test", Requests: 2}}}
+	if r := engine.Step(); !r.AvoidedColdStart {
+		t.Errorf("expected an avoided cold start")
+	}
+
+	clock.Step(5 * time.Second)
+	if r := engine.Step(); r.AvoidedColdStart {
+		t.Errorf("unexpected second avoided cold start")
+	}
+}
+
+func TestActivationReplicas(t *testing.T) {
+	var scenarios = []struct {
+		activation Activation
+		held       int
+		replicas   int32
+	}{
+		// 0: One replica by default
+		{activation: Activation{}, held: 200, replicas: 1},
+		// 1: Replicas to absorb the held requests
+		{activation: Activation{TargetConcurrency: 10}, held: 35, replicas: 4},
+		// 2: At least one replica
+		{activation: Activation{TargetConcurrency: 10}, held: 0, replicas: 1},
+		// 3: Capped by the maximum
+		{activation: Activation{TargetConcurrency: 10, MaxReplicas: 5}, held: 200, replicas: 5},
+	}
+
+	for i, scenario := range scenarios {
+		if replicas := scenario.activation.Replicas(scenario.held); replicas != scenario.replicas {
+			t.Errorf("%v: expected %v replicas but got %v", i, scenario.replicas, replicas)
+		}
+	}
+
+	clock := NewFakeClock(time.Unix(1000, 0))
+	client := NewFakeClient(clock, 0, 0)
+	source := &fakeSource{stats: &metrics.Proxy{WaitingForPods: true, HeldRequests: 200, PendingRequests: 200}}
+
+	engine := NewEngine(&policy.LastRequest{IdleAfter: time.Minute}, source, client, clock, "default", "test")
+	engine.SetActivation(Activation{TargetConcurrency: 50, MaxReplicas: 10})
+
+	r := engine.Step()
+	if !r.Scaled() || r.Replicas != 4 {
+		t.Errorf("expected a scale up to 4 replicas but got %+v", r)
+	}
+}
+
+type fixedPolicy policy.Decision
+
+func (p *fixedPolicy) Name() string {
+	return "fixed"
+}
+
+func (p *fixedPolicy) Decide(snapshot *policy.Snapshot, target *policy.Target, clock policy.Clock) policy.Decision {
+	return policy.Decision(*p)
+}
+
+func TestSimulation(t *testing.T) {
+	trace := `# two bursts of requests separated by one hour
+1561370400 0.1
+1561370401 0.1
+1561370402 0.1
+1561374000 0.1
+1561374001 0.1
+`
+
+	requests, err := ParseTrace(strings.NewReader(trace))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := &Simulation{
+		Policy:          &policy.LastRequest{IdleAfter: 90 * time.Second},
+		Retention:       5 * time.Minute,
+		Interval:        5 * time.Second,
+		ActivationDelay: 20 * time.Second,
+		Replicas:        1,
+	}
+
+	report, err := s.Run(requests)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.Requests != 5 {
+		t.Errorf("expected 5 requests but got %v", report.Requests)
+	}
+
+	if report.ColdStarts != 1 {
+		t.Errorf("expected 1 cold start but got %v", report.ColdStarts)
+	}
+
+	if report.HeldRequests != 2 {
+		t.Errorf("expected 2 held requests but got %v", report.HeldRequests)
+	}
+
+	if report.MaxHeldWait <= 0 || report.MaxHeldWait > 25*time.Second {
+		t.Errorf("unexpected maximum held wait %v", report.MaxHeldWait)
+	}
+
+	if report.Sleeps != 1 {
+		t.Errorf("expected 1 sleep but got %v", report.Sleeps)
+	}
+
+	if report.ReplicaHoursSaved < 0.9 {
+		t.Errorf("expected at least 0.9 replica hours saved but got %v", report.ReplicaHoursSaved)
+	}
+}
+
+func TestEngineDecisions(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	client := NewFakeClient(clock, 1, 0)
+	source := &fakeSource{stats: &metrics.Proxy{LastRequest: 10, EndpointCount: 1}}
+
+	engine := NewEngine(&policy.LastRequest{IdleAfter: time.Minute}, source, client, clock, "default", "test")
+
+	// repeated decisions are recorded once
+	for i := 0; i < 3; i++ {
+		engine.Step()
+		clock.Step(5 * time.Second)
+	}
+
+	source.stats = &metrics.Proxy{LastRequest: 120, EndpointCount: 1}
+	engine.Step()
+
+	decisions := engine.Decisions()
+	if len(decisions) != 2 {
+		t.Fatalf("expected 2 decisions but got %v", len(decisions))
+	}
+
+	if decisions[0].Scaled || decisions[0].Direction != "" {
+		t.Errorf("unexpected first decision %+v", decisions[0])
+	}
+
+	if !decisions[1].Scaled || decisions[1].Direction != Down || decisions[1].Action != policy.Sleep {
+		t.Errorf("expected a scale down but got %+v", decisions[1])
+	}
+}
+
+func TestEngineStabilization(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	client := NewFakeClient(clock, 0, 0)
+	source := &fakeSource{}
+	sleep := &fixedPolicy{Action: policy.Sleep, Policy: "fixed", Reason: "idle"}
+
+	engine := NewEngine(sleep, source, client, clock, "default", "test")
+	engine.SetStabilization(Stabilization{
+		MinAwake:          5 * time.Minute,
+		Window:            time.Minute,
+		FlapMaxWakes:      2,
+		FlapIdleExtension: 10 * time.Minute,
+	})
+
+	wake := func() {
+		source.stats = &metrics.Proxy{WaitingForPods: true, HeldRequests: 1, PendingRequests: 1}
+		if r := engine.Step(); !r.Scaled() || r.Direction != Up {
+			t.Fatalf("expected a scale up but got %+v", r)
+		}
+
+		source.stats = &metrics.Proxy{EndpointCount: 1}
+	}
+
+	// the first wake is protected by the minimum awake time
+	wake()
+	clock.Step(time.Minute)
+	if r := engine.Step(); r.Scaled() || !strings.Contains(r.Decision.Reason, "minimum awake time") {
+		t.Errorf("expected a postponed scale down due the minimum awake time but got %+v", r)
+	}
+
+	if status := engine.Status(); status.MinAwakeUntil == nil || status.SleepPendingSince == nil {
+		t.Errorf("expected a pending scale down in the status but got %+v", status)
+	}
+
+	// the policies decided Sleep during the stabilization window
+	clock.Step(5 * time.Minute)
+	if r := engine.Step(); !r.Scaled() || r.Direction != Down {
+		t.Errorf("expected a scale down but got %+v", r)
+	}
+
+	// a decision different from Sleep restarts the stabilization window
+	wake()
+	clock.Step(5 * time.Minute)
+	sleep.Action = policy.None
+	engine.Step()
+	sleep.Action = policy.Sleep
+	if r := engine.Step(); r.Scaled() || !strings.Contains(r.Decision.Reason, "stabilization window") {
+		t.Errorf("expected a postponed scale down due the stabilization window but got %+v", r)
+	}
+
+	clock.Step(time.Minute)
+	if r := engine.Step(); !r.Scaled() {
+		t.Errorf("expected a scale down but got %+v", r)
+	}
+
+	// the third wake in the last hour extends the idle time
+	wake()
+	clock.Step(5 * time.Minute)
+	if r := engine.Step(); r.Scaled() || !strings.Contains(r.Decision.Reason, "flapping") {
+		t.Errorf("expected a postponed scale down due flapping but got %+v", r)
+	}
+
+	if status := engine.Status(); !status.Flapping || status.WakesLastHour != 3 {
+		t.Errorf("expected a flapping deployment but got %+v", status)
+	}
+
+	clock.Step(11 * time.Minute)
+	if r := engine.Step(); !r.Scaled() {
+		t.Errorf("expected a scale down but got %+v", r)
+	}
+
+	// forced decisions are not stabilized
+	wake()
+	sleep.Force = true
+	if r := engine.Step(); !r.Scaled() || r.Direction != Down {
+		t.Errorf("expected a forced scale down but got %+v", r)
+	}
+}
+
+func TestParseOverride(t *testing.T) {
+	until := time.Date(2019, 6, 24, 18, 0, 0, 0, time.UTC)
+
+	var scenarios = []struct {
+		annotations map[string]string
+		override    Override
+		err         bool
+	}{
+		// 0: No annotations
+		{annotations: nil, override: Override{}},
+		// 1: All the annotations
+		{
+			annotations: map[string]string{
+				PausedAnnotation:         "true",
+				KeepAwakeUntilAnnotation: "2019-06-24T18:00:00Z",
+				ForceSleepAnnotation:     "false",
+			},
+			override: Override{Paused: true, KeepAwakeUntil: &until},
+		},
+		// 2: Invalid boolean
+		{annotations: map[string]string{PausedAnnotation: "yes please"}, err: true},
+		// 3: Invalid time
+		{annotations: map[string]string{KeepAwakeUntilAnnotation: "tomorrow"}, err: true},
+	}
+
+	for i, scenario := range scenarios {
+		override, err := ParseOverride(scenario.annotations)
+		if scenario.err {
+			if err == nil {
+				t.Errorf("%v: expected an error", i)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(override, scenario.override) {
+			t.Errorf("%v: expected %+v but got %+v", i, scenario.override, override)
+		}
+	}
+}
+
+func TestEngineOverride(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	client := NewFakeClient(clock, 0, 0)
+	source := &fakeSource{stats: &metrics.Proxy{WaitingForPods: true, HeldRequests: 1, PendingRequests: 1}}
+
+	engine := NewEngine(&policy.LastRequest{IdleAfter: time.Minute}, source, client, clock, "default", "test")
+
+	// held requests keep waiting during a forced sleep
+	engine.SetOverride(Override{ForceSleep: true})
+	if r := engine.Step(); r.Scaled() {
+		t.Errorf("expected no scale operation while forced to sleep but got %+v", r)
+	}
+
+	// the deployment is woken and kept awake while idle
+	until := clock.Now().Add(time.Hour)
+	engine.SetOverride(Override{KeepAwakeUntil: &until, ForceSleep: true})
+	source.stats = &metrics.Proxy{LastRequest: 600}
+	if r := engine.Step(); !r.Scaled() || r.Direction != Up {
+		t.Errorf("expected a scale up but got %+v", r)
+	}
+
+	source.stats = &metrics.Proxy{LastRequest: 600, EndpointCount: 1}
+	if r := engine.Step(); r.Scaled() || r.Decision.Action != policy.Wake {
+		t.Errorf("expected the deployment to be kept awake but got %+v", r)
+	}
+
+	// the forced sleep applies once the keep awake period expires
+	clock.Step(time.Hour)
+	if r := engine.Step(); !r.Scaled() || r.Direction != Down {
+		t.Errorf("expected a forced scale down but got %+v", r)
+	}
+
+	if status := engine.Status(); status.Override == nil || status.Override.KeepAwakeUntil != nil {
+		t.Errorf("expected an expired keep awake period in the status but got %+v", status)
+	}
+}
+
+func TestEnginePaused(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	client := NewFakeClient(clock, 1, 0)
+	source := &fakeSource{stats: &metrics.Proxy{LastRequest: 600, EndpointCount: 1}}
+
+	engine := NewEngine(&policy.LastRequest{IdleAfter: time.Minute}, source, client, clock, "default", "test")
+	engine.SetOverride(Override{Paused: true, ForceSleep: true})
+
+	// a paused deployment is not scaled to zero, not even when forced
+	if r := engine.Step(); r.Scaled() || r.Decision.Policy != OverridePolicy || r.Decision.Action != policy.None {
+		t.Errorf("expected no scale operation while paused but got %+v", r)
+	}
+
+	if status := engine.Status(); status.Override == nil || !status.Override.Paused {
+		t.Errorf("expected the override in the status but got %+v", status)
+	}
+
+	// held requests wake a paused deployment
+	client = NewFakeClient(clock, 0, 0)
+	source.stats = &metrics.Proxy{WaitingForPods: true, HeldRequests: 1, PendingRequests: 1}
+
+	engine = NewEngine(&policy.LastRequest{IdleAfter: time.Minute}, source, client, clock, "default", "test")
+	engine.SetOverride(Override{Paused: true})
+	if r := engine.Step(); !r.Scaled() || r.Direction != Up {
+		t.Errorf("expected a scale up of a paused deployment with held requests but got %+v", r)
+	}
+}
+
+func TestParseDemand(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	var scenarios = []struct {
+		value  string
+		demand *Demand
+	}{
+		// 0: Wake with the default duration
+		{value: "wake", demand: &Demand{Action: policy.Wake, Replicas: 1, Until: now.Add(DefaultDemandDuration), Source: "annotation"}},
+		// 1: Wake for a duration
+		{value: "wake:1h", demand: &Demand{Action: policy.Wake, Replicas: 1, Until: now.Add(time.Hour), Source: "annotation"}},
+		// 2: Sleep
+		{value: "sleep", demand: &Demand{Action: policy.Sleep, Source: "annotation"}},
+		// 3: Wake for a duration with replicas
+		{value: "wake:30m0s:3", demand: &Demand{Action: policy.Wake, Replicas: 3, Until: now.Add(30 * time.Minute), Source: "annotation"}},
+		// 4: Invalid duration
+		{value: "wake:soon"},
+		// 5: Invalid replicas
+		{value: "wake:1h:0"},
+		// 6: Invalid action
+		{value: "restart"},
+	}
+
+	for i, scenario := range scenarios {
+		demand, err := ParseDemand(scenario.value, now)
+		if scenario.demand == nil {
+			if err == nil {
+				t.Errorf("%v: expected an error", i)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(demand, scenario.demand) {
+			t.Errorf("%v: expected %+v but got %+v", i, scenario.demand, demand)
+		}
+
+		// the annotation of a demand returns the same demand
+		again, err := ParseDemand(demand.Annotation(now), now)
+		if err != nil || again.Action != demand.Action || again.Replicas != demand.Replicas || !again.Until.Equal(demand.Until) {
+			t.Errorf("%v: expected %+v from the annotation %v but got %+v (%v)", i, demand, demand.Annotation(now), again, err)
+		}
+	}
+}
+
+func TestEngineDemand(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	client := NewFakeClient(clock, 0, 0)
+	source := &fakeSource{stats: &metrics.Proxy{LastRequest: 600}}
+
+	engine := NewEngine(&policy.LastRequest{IdleAfter: time.Minute}, source, client, clock, "default", "test")
+	engine.SetStabilization(Stabilization{MinAwake: time.Hour})
+
+	// the deployment is woken without requests and kept awake while idle
+	engine.Demand(Demand{Action: policy.Wake, Replicas: 2, Until: clock.Now().Add(10 * time.Minute), Source: "test"})
+	if r := engine.Step(); !r.Scaled() || r.Replicas != 2 || r.Decision.Policy != DemandPolicy {
+		t.Errorf("expected a scale up to 2 replicas on demand but got %+v", r)
+	}
+
+	source.stats = &metrics.Proxy{LastRequest: 600, EndpointCount: 2}
+	clock.Step(5 * time.Minute)
+	if r := engine.Step(); r.Decision.Action != policy.Wake {
+		t.Errorf("expected the deployment to be kept awake but got %+v", r)
+	}
+
+	// a sleep on demand is not stabilized and is applied only once
+	engine.Demand(Demand{Action: policy.Sleep, Source: "test"})
+	if r := engine.Step(); !r.Scaled() || r.Direction != Down {
+		t.Errorf("expected a scale down on demand but got %+v", r)
+	}
+
+	if r := engine.Step(); r.Decision.Policy == DemandPolicy {
+		t.Errorf("expected the decision of the policy but got %+v", r)
+	}
+
+	// overrides take precedence
+	engine.SetOverride(Override{ForceSleep: true})
+	err := engine.Demand(Demand{Action: policy.Wake, Replicas: 1, Until: clock.Now().Add(time.Minute), Source: "test"})
+	if _, ok := err.(*RejectedDemandError); !ok {
+		t.Errorf("expected a rejected demand but got %v", err)
+	}
+
+	if r := engine.Step(); r.Scaled() || r.Decision.Policy != OverridePolicy {
+		t.Errorf("expected the override decision but got %+v", r)
+	}
+}
+
+func TestEngineSleepDemand(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	client := NewFakeClient(clock, 1, 0)
+	source := &fakeSource{stats: &metrics.Proxy{LastRequest: 0, EndpointCount: 1, PendingRequests: 1}}
+
+	engine := NewEngine(&policy.LastRequest{IdleAfter: time.Minute}, source, client, clock, "default", "test")
+
+	// the sleep is kept while the deployment processes requests
+	if err := engine.Demand(Demand{Action: policy.Sleep, Source: "test"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if r := engine.Step(); r.Scaled() || r.Decision.Policy != DemandPolicy {
+		t.Errorf("expected a postponed sleep on demand but got %+v", r)
+	}
+
+	source.stats = &metrics.Proxy{LastRequest: 0, EndpointCount: 1}
+	if r := engine.Step(); !r.Scaled() || r.Direction != Down {
+		t.Errorf("expected a scale down on demand but got %+v", r)
+	}
+
+	// a pause rejects a sleep and supersedes a pending one
+	source.stats = &metrics.Proxy{LastRequest: 0, EndpointCount: 1, PendingRequests: 1}
+	if err := engine.Demand(Demand{Action: policy.Sleep, Source: "test"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	engine.SetOverride(Override{Paused: true})
+	if r := engine.Step(); r.Decision.Policy == DemandPolicy {
+		t.Errorf("expected the demand to be superseded by the pause but got %+v", r)
+	}
+
+	err := engine.Demand(Demand{Action: policy.Sleep, Source: "test"})
+	if _, ok := err.(*RejectedDemandError); !ok {
+		t.Errorf("expected a rejected demand but got %v", err)
+	}
+
+	engine.SetOverride(Override{})
+	source.stats = &metrics.Proxy{LastRequest: 0, EndpointCount: 1}
+	if r := engine.Step(); r.Decision.Policy == DemandPolicy {
+		t.Errorf("expected no sleep after the demand was superseded but got %+v", r)
+	}
+}
+
+type fakePeers []Peer
+
+func (p fakePeers) Peers() []Peer {
+	return p
+}
+
+func TestEnginePeers(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	client := NewFakeClient(clock, 1, 0)
+	source := &fakeSource{stats: &metrics.Proxy{LastRequest: 600, EndpointCount: 1}}
+
+	peers := fakePeers{{Name: "proxy-b", Time: clock.Now(), Idle: false}}
+
+	engine := NewEngine(&policy.LastRequest{IdleAfter: time.Minute}, source, client, clock, "default", "test")
+	engine.SetPeers(peers)
+
+	// another replica of the proxy is receiving requests
+	if r := engine.Step(); r.Scaled() || !strings.Contains(r.Decision.Reason, "proxy-b") {
+		t.Errorf("expected a postponed scale down due an active replica but got %+v", r)
+	}
+
+	// the other replica is idle but processing a request
+	peers[0] = Peer{Name: "proxy-b", Time: clock.Now(), Idle: true, ActiveRequests: 1}
+	if r := engine.Step(); r.Scaled() {
+		t.Errorf("expected a postponed scale down due an active request but got %+v", r)
+	}
+
+	// all the replicas are idle
+	peers[0] = Peer{Name: "proxy-b", Time: clock.Now(), Idle: true}
+	if r := engine.Step(); !r.Scaled() || r.Direction != Down {
+		t.Errorf("expected a scale down but got %+v", r)
+	}
+}
+
+func TestEnginePeerHeldRequests(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	client := NewFakeClient(clock, 0, 0)
+	source := &fakeSource{stats: &metrics.Proxy{LastRequest: 600}}
+
+	peers := fakePeers{{Name: "proxy-b", Time: clock.Now(), Idle: true, HeldRequests: 25}}
+
+	engine := NewEngine(&policy.LastRequest{IdleAfter: time.Minute}, source, client, clock, "default", "test")
+	engine.SetActivation(Activation{TargetConcurrency: 10})
+	engine.SetPeers(peers)
+
+	// another replica of the proxy holds requests while this one holds none
+	r := engine.Step()
+	if !r.Scaled() || r.Direction != Up || r.Replicas != 3 || r.Decision.Policy != HeldRequestsPolicy {
+		t.Errorf("expected a scale up to 3 replicas due the held requests of other replicas but got %+v", r)
+	}
+
+	if r.ColdStart != 0 {
+		t.Errorf("expected no cold start of this replica but got %v", r.ColdStart)
+	}
+
+	if !strings.Contains(r.Decision.Reason, "25 in other proxy replicas") {
+		t.Errorf("expected the held requests of other replicas in the reason but got %q", r.Decision.Reason)
+	}
+}
+
+func TestEngineObserve(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	client := NewFakeClient(clock, 1, 0)
+	source := &fakeSource{stats: &metrics.Proxy{LastRequest: 600, EndpointCount: 1}}
+
+	engine := NewEngine(&policy.LastRequest{IdleAfter: time.Minute}, source, client, clock, "default", "test")
+
+	// a replica that is not the leader evaluates the policies without scaling
+	r := engine.Observe()
+	if r.Scaled() || r.Decision.Action != policy.Sleep {
+		t.Errorf("expected a sleep decision without scaling but got %+v", r)
+	}
+
+	if len(client.Calls) != 0 {
+		t.Errorf("expected no scale calls but got %v", client.Calls)
+	}
+}
@@ -0,0 +1,107 @@
+package scaler
+
+import (
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aledbf/horus-proxy/pkg/policy"
+)
+
+// FakeClock is a Clock that only changes when it is moved forward
+type FakeClock struct {
+	mu  sync.RWMutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock set to now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now: now,
+	}
+}
+
+// Now returns the current time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.now
+}
+
+// Step moves the clock forward
+func (c *FakeClock) Step(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// FakeClient is a Client that changes the replicas of a simulated deployment.
+// The new replicas are ready after the activation delay.
+type FakeClient struct {
+	// ActivationDelay time new replicas take to be ready
+	ActivationDelay time.Duration
+
+	clock policy.Clock
+
+	replicas int32
+	readyAt  time.Time
+
+	// Calls replicas requested in the changes of the deployment
+	Calls []int32
+}
+
+// NewFakeClient returns a FakeClient with ready replicas
+func NewFakeClient(clock policy.Clock, replicas int32, activationDelay time.Duration) *FakeClient {
+	return &FakeClient{
+		ActivationDelay: activationDelay,
+		clock:           clock,
+		replicas:        replicas,
+		readyAt:         clock.Now(),
+	}
+}
+
+// Scale changes the replicas of the simulated deployment
+func (c *FakeClient) Scale(replicas int32) (*appsv1.Deployment, error) {
+	if c.replicas == replicas || (replicas > 0 && c.replicas > replicas) {
+		return nil, nil
+	}
+
+	if replicas > c.replicas {
+		c.readyAt = c.clock.Now().Add(c.ActivationDelay)
+	}
+
+	c.replicas = replicas
+	c.Calls = append(c.Calls, replicas)
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "fake",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+		},
+	}, nil
+}
+
+// Replicas returns the desired replicas of the simulated deployment
+func (c *FakeClient) Replicas() int32 {
+	return c.replicas
+}
+
+// ReadyAt returns the time the replicas of the simulated deployment are ready
+func (c *FakeClient) ReadyAt() time.Time {
+	return c.readyAt
+}
+
+// ReadyReplicas returns the ready replicas of the simulated deployment at a time
+func (c *FakeClient) ReadyReplicas(at time.Time) int32 {
+	if at.Before(c.readyAt) {
+		return 0
+	}
+
+	return c.replicas
+}
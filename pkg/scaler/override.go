@@ -0,0 +1,126 @@
+package scaler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/policy"
+)
+
+// OverridePolicy name used in the decisions of the overrides
+const OverridePolicy = "override"
+
+// Annotations of the deployment that override the decisions of the policies
+const (
+	// PausedAnnotation stops scaling the deployment to zero ("true")
+	PausedAnnotation = "horus-proxy/paused"
+	// KeepAwakeUntilAnnotation keeps the deployment awake until a time (RFC3339)
+	KeepAwakeUntilAnnotation = "horus-proxy/keep-awake-until"
+	// ForceSleepAnnotation scales the deployment to zero and holds the requests ("true")
+	ForceSleepAnnotation = "horus-proxy/force-sleep"
+)
+
+// Override of the decisions of the policies set by an operator, i.e. during an incident.
+// Paused takes precedence over ForceSleep, and KeepAwakeUntil over ForceSleep
+type Override struct {
+	// Paused the deployment is not scaled to zero. Held requests still wake it
+	Paused bool `json:"paused,omitempty"`
+	// KeepAwakeUntil the deployment is woken and kept awake until this time
+	KeepAwakeUntil *time.Time `json:"keepAwakeUntil,omitempty"`
+	// ForceSleep the deployment is scaled to zero and requests are held
+	ForceSleep bool `json:"forceSleep,omitempty"`
+}
+
+// ParseOverride returns the override defined in the annotations of a deployment
+func ParseOverride(annotations map[string]string) (Override, error) {
+	o := Override{}
+
+	var err error
+	if value, ok := annotations[PausedAnnotation]; ok {
+		o.Paused, err = strconv.ParseBool(value)
+		if err != nil {
+			return o, fmt.Errorf("invalid %v annotation %q: %v", PausedAnnotation, value, err)
+		}
+	}
+
+	if value, ok := annotations[ForceSleepAnnotation]; ok {
+		o.ForceSleep, err = strconv.ParseBool(value)
+		if err != nil {
+			return o, fmt.Errorf("invalid %v annotation %q: %v", ForceSleepAnnotation, value, err)
+		}
+	}
+
+	if value, ok := annotations[KeepAwakeUntilAnnotation]; ok {
+		until, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return o, fmt.Errorf("invalid %v annotation %q: %v", KeepAwakeUntilAnnotation, value, err)
+		}
+
+		o.KeepAwakeUntil = &until
+	}
+
+	return o, nil
+}
+
+// active returns the override applied at a time. Expired keep awake periods are ignored
+func (o Override) active(now time.Time) Override {
+	if o.KeepAwakeUntil != nil && !now.Before(*o.KeepAwakeUntil) {
+		o.KeepAwakeUntil = nil
+	}
+
+	return o
+}
+
+// decide returns the decision replacing the one of the policies. Returns false without override
+func (o Override) decide(now time.Time) (policy.Decision, bool) {
+	o = o.active(now)
+
+	switch {
+	case o.KeepAwakeUntil != nil:
+		return policy.Decision{
+			Action:   policy.Wake,
+			Replicas: 1,
+			Reason:   fmt.Sprintf("kept awake until %v by the %v annotation", o.KeepAwakeUntil.Format(time.RFC3339), KeepAwakeUntilAnnotation),
+			Policy:   OverridePolicy,
+		}, true
+	case o.ForceSleep:
+		return policy.Decision{
+			Action: policy.Sleep,
+			Force:  true,
+			Reason: fmt.Sprintf("forced to sleep by the %v annotation", ForceSleepAnnotation),
+			Policy: OverridePolicy,
+		}, true
+	}
+
+	return policy.Decision{}, false
+}
+
+// pause replaces a scale down with no action while the scaling is paused
+func (o Override) pause(decision policy.Decision) policy.Decision {
+	if !o.Paused || decision.Action != policy.Sleep {
+		return decision
+	}
+
+	return policy.Decision{
+		Action: policy.None,
+		Reason: fmt.Sprintf("%v (paused by the %v annotation)", decision.Reason, PausedAnnotation),
+		Policy: OverridePolicy,
+	}
+}
+
+// Rejects returns an error if the override prevents applying the demand at a time
+func (o Override) Rejects(d Demand, now time.Time) error {
+	o = o.active(now)
+
+	switch {
+	case d.Action == policy.Sleep && o.Paused:
+		return &RejectedDemandError{Reason: fmt.Sprintf("paused by the %v annotation", PausedAnnotation)}
+	case d.Action == policy.Sleep && o.KeepAwakeUntil != nil:
+		return &RejectedDemandError{Reason: fmt.Sprintf("kept awake until %v by the %v annotation", o.KeepAwakeUntil.Format(time.RFC3339), KeepAwakeUntilAnnotation)}
+	case d.Action == policy.Wake && o.ForceSleep && o.KeepAwakeUntil == nil:
+		return &RejectedDemandError{Reason: fmt.Sprintf("forced to sleep by the %v annotation", ForceSleepAnnotation)}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package scaler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Peer is the activity of another replica of the proxy of the deployment
+type Peer struct {
+	// Name of the replica
+	Name string `json:"name"`
+	// Time of the last heartbeat of the replica
+	Time time.Time `json:"time"`
+	// Idle is true if the policies of the replica decided Sleep
+	Idle bool `json:"idle"`
+	// ActiveRequests number of requests being processed by the replica
+	ActiveRequests int `json:"activeRequests"`
+	// HeldRequests number of requests the replica is holding
+	HeldRequests int `json:"heldRequests"`
+	// Requests number of requests processed by the replica since NGINX started
+	Requests int64 `json:"requests"`
+}
+
+// Peers provides the activity of the other replicas of the proxy
+type Peers interface {
+	// Peers returns the replicas with a recent heartbeat
+	Peers() []Peer
+}
+
+// Busy returns true if the replica has activity and the deployment must not sleep
+func (p Peer) Busy() bool {
+	return !p.Idle || p.ActiveRequests > 0 || p.HeldRequests > 0
+}
+
+// busyPeers returns the names of the replicas with activity
+func busyPeers(peers Peers) string {
+	if peers == nil {
+		return ""
+	}
+
+	var busy []string
+	for _, peer := range peers.Peers() {
+		if peer.Busy() {
+			busy = append(busy, peer.Name)
+		}
+	}
+
+	if len(busy) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("active proxy replicas %v", strings.Join(busy, ", "))
+}
+
+// heldPeerRequests returns the number of requests held by the other replicas
+func heldPeerRequests(peers Peers) int {
+	if peers == nil {
+		return 0
+	}
+
+	held := 0
+	for _, peer := range peers.Peers() {
+		held += peer.HeldRequests
+	}
+
+	return held
+}
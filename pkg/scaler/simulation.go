@@ -0,0 +1,286 @@
+package scaler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/metrics"
+	"github.com/aledbf/horus-proxy/pkg/policy"
+)
+
+// simulationBackend name of the backend used in the synthetic stats
+const simulationBackend = "simulation"
+
+// Request is a request of a recorded traffic trace
+type Request struct {
+	// Time the request was received
+	Time time.Time
+	// Duration time the endpoints took to process the request
+	Duration time.Duration
+}
+
+// ParseTrace reads a traffic trace. Every line contains the time of a request,
+// as unix time in seconds or RFC3339, and optionally the duration of the request
+// in seconds. Empty lines and lines starting with # are ignored.
+func ParseTrace(r io.Reader) ([]Request, error) {
+	var requests []Request
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		t, err := parseTraceTime(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+
+		request := Request{Time: t}
+		if len(fields) > 1 {
+			seconds, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil || seconds < 0 {
+				return nil, fmt.Errorf("line %v: invalid duration %q", line, fields[1])
+			}
+
+			request.Duration = time.Duration(seconds * float64(time.Second))
+		}
+
+		requests = append(requests, request)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].Time.Before(requests[j].Time)
+	})
+
+	return requests, nil
+}
+
+func parseTraceTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return unixTime(seconds), nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (expected unix time or RFC3339)", value)
+	}
+
+	return t, nil
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// Simulation replays a traffic trace using the scaling engine
+type Simulation struct {
+	// Policy used to scale the deployment
+	Policy policy.Policy
+	// Retention period of time of the history of requests available to the policies
+	Retention time.Duration
+	// Interval time between evaluations of the engine
+	Interval time.Duration
+	// ActivationDelay time the new replicas take to be ready
+	ActivationDelay time.Duration
+	// Replicas running without scaling to zero. This is the replicas at the start of the trace
+	Replicas int32
+	// Activation sizes the scale from zero due held requests
+	Activation Activation
+	// Stabilization of the scale operations
+	Stabilization Stabilization
+}
+
+// Report summarizes the result of a simulation
+type Report struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Requests number of requests in the trace
+	Requests int `json:"requests"`
+	// ColdStarts number of times the deployment was scaled from zero due held requests
+	ColdStarts int `json:"coldStarts"`
+	// AvoidedColdStarts number of times the deployment was woken from zero by a
+	// policy and processed the first requests without holding them
+	AvoidedColdStarts int `json:"avoidedColdStarts"`
+	// HeldRequests number of requests that waited for the deployment to be ready
+	HeldRequests int `json:"heldRequests"`
+	// MaxHeldWait maximum time a request waited for the deployment to be ready
+	MaxHeldWait time.Duration `json:"maxHeldWait"`
+	// Wakes number of times the deployment was scaled up
+	Wakes int `json:"wakes"`
+	// Sleeps number of times the deployment was scaled to zero
+	Sleeps int `json:"sleeps"`
+	// ReplicaHours used by the deployment
+	ReplicaHours float64 `json:"replicaHours"`
+	// BaselineReplicaHours used by the deployment without scaling to zero
+	BaselineReplicaHours float64 `json:"baselineReplicaHours"`
+	// ReplicaHoursSaved difference between the baseline and the replica hours used
+	ReplicaHoursSaved float64 `json:"replicaHoursSaved"`
+}
+
+// inflight is a request released to the endpoints
+type inflight struct {
+	start time.Time
+	end   time.Time
+}
+
+// Run replays the requests and returns a report of the scaling of the deployment
+func (s *Simulation) Run(trace []Request) (*Report, error) {
+	if len(trace) == 0 {
+		return nil, fmt.Errorf("the trace does not contain requests")
+	}
+
+	if s.Interval <= 0 {
+		return nil, fmt.Errorf("invalid interval %v", s.Interval)
+	}
+
+	start := trace[0].Time.Truncate(s.Interval)
+
+	end := start
+	for _, request := range trace {
+		if e := request.Time.Add(request.Duration); e.After(end) {
+			end = e
+		}
+	}
+
+	clock := NewFakeClock(start)
+	client := NewFakeClient(clock, s.Replicas, s.ActivationDelay)
+	collector := metrics.NewCollector(s.Retention)
+	engine := NewEngine(s.Policy, collector, client, clock, "default", simulationBackend)
+	engine.SetActivation(s.Activation)
+	engine.SetStabilization(s.Stabilization)
+
+	report := &Report{
+		Start:    start,
+		Requests: len(trace),
+	}
+
+	var (
+		next      int
+		held      []Request
+		released  []inflight
+		completed int64
+	)
+
+	lastRequest := start
+
+	// the simulation continues until all the requests were processed
+	now := start
+	for ; next < len(trace) || len(held) > 0 || len(released) > 0 || !now.After(end); now = now.Add(s.Interval) {
+		clock.Step(now.Sub(clock.Now()))
+
+		// requests received since the previous evaluation
+		for ; next < len(trace) && !trace[next].Time.After(now); next++ {
+			request := trace[next]
+			if client.ReadyReplicas(request.Time) > 0 {
+				released = append(released, inflight{request.Time, request.Time.Add(request.Duration)})
+				continue
+			}
+
+			held = append(held, request)
+		}
+
+		// held requests are released when the deployment is ready
+		if client.ReadyReplicas(now) > 0 && len(held) > 0 {
+			for _, request := range held {
+				releasedAt := client.ReadyAt()
+				if request.Time.After(releasedAt) {
+					releasedAt = request.Time
+				}
+
+				if wait := releasedAt.Sub(request.Time); wait > report.MaxHeldWait {
+					report.MaxHeldWait = wait
+				}
+
+				released = append(released, inflight{releasedAt, releasedAt.Add(request.Duration)})
+			}
+
+			report.HeldRequests += len(held)
+			held = nil
+		}
+
+		active := 0
+		pending := released[:0]
+		for _, request := range released {
+			if request.end.After(now) {
+				pending = append(pending, request)
+				if !request.start.After(now) {
+					active++
+				}
+
+				continue
+			}
+
+			completed++
+			if request.end.After(lastRequest) {
+				lastRequest = request.end
+			}
+		}
+		released = pending
+
+		endpoints := int(client.ReadyReplicas(now))
+
+		collector.Record(&metrics.Stats{
+			Version:   metrics.StatsVersion,
+			Timestamp: unixSeconds(now),
+			Backends: []metrics.Backend{
+				{
+					Name:           simulationBackend,
+					HeldRequests:   len(held),
+					ActiveRequests: active,
+					LastRequest:    unixSeconds(lastRequest),
+					Endpoints:      endpoints,
+					Requests:       completed,
+				},
+			},
+		})
+
+		replicas := client.Replicas()
+
+		r := engine.Step()
+		if r.Err != nil {
+			return nil, r.Err
+		}
+
+		if r.AvoidedColdStart {
+			report.AvoidedColdStarts++
+		}
+
+		if r.Scaled() {
+			switch r.Direction {
+			case Up:
+				report.Wakes++
+				if replicas == 0 && r.Decision.Policy == HeldRequestsPolicy {
+					report.ColdStarts++
+				}
+			case Down:
+				report.Sleeps++
+			}
+		}
+
+		report.ReplicaHours += float64(client.Replicas()) * s.Interval.Hours()
+		report.BaselineReplicaHours += float64(s.Replicas) * s.Interval.Hours()
+	}
+
+	report.End = now
+	report.ReplicaHoursSaved = report.BaselineReplicaHours - report.ReplicaHours
+
+	return report, nil
+}
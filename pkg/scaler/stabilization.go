@@ -0,0 +1,160 @@
+package scaler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aledbf/horus-proxy/pkg/env"
+)
+
+// flapPeriod period of time evaluated by the flap detector
+const flapPeriod = time.Hour
+
+// Stabilization prevents the deployment from sleeping right after waking
+// and from oscillating between awake and asleep with sparse traffic
+type Stabilization struct {
+	// MinAwake minimum time the deployment stays awake after a scale up
+	MinAwake time.Duration
+	// Window time the policies must decide Sleep continuously before scaling down
+	Window time.Duration
+	// FlapMaxWakes maximum number of scale ups in the last hour before the
+	// deployment is considered flapping. Zero disables the detection
+	FlapMaxWakes int
+	// FlapIdleExtension additional time the policies must decide Sleep while flapping
+	FlapIdleExtension time.Duration
+}
+
+// NewStabilization returns the stabilization of the scale operations defined in the configuration
+func NewStabilization(config *env.Spec) Stabilization {
+	return Stabilization{
+		MinAwake:          config.MinAwake,
+		Window:            config.ScaleDownStabilization,
+		FlapMaxWakes:      config.FlapMaxWakes,
+		FlapIdleExtension: config.FlapIdleExtension,
+	}
+}
+
+// Status describes the stabilization of the deployment and the override of the policies
+type Status struct {
+	// AwakeSince time of the last scale up
+	AwakeSince *time.Time `json:"awakeSince,omitempty"`
+	// MinAwakeUntil the deployment is not scaled down before this time
+	MinAwakeUntil *time.Time `json:"minAwakeUntil,omitempty"`
+	// SleepPendingSince time the policies started to decide Sleep
+	SleepPendingSince *time.Time `json:"sleepPendingSince,omitempty"`
+	// SleepAfter the deployment is not scaled down before this time
+	SleepAfter *time.Time `json:"sleepAfter,omitempty"`
+	// WakesLastHour number of scale ups in the last hour
+	WakesLastHour int `json:"wakesLastHour"`
+	// Flapping is true if the deployment was scaled up more than FlapMaxWakes times in the last hour
+	Flapping bool `json:"flapping"`
+	// IdleExtension additional time the policies must decide Sleep due flapping
+	IdleExtension string `json:"idleExtension,omitempty"`
+	// Override of the decisions of the policies. Empty without override
+	Override *Override `json:"override,omitempty"`
+}
+
+// stabilizer keeps the state required to stabilize the scale operations
+type stabilizer struct {
+	Stabilization
+
+	// time of the last scale up
+	awakeSince *time.Time
+	// time the policies started to decide Sleep
+	sleepSince *time.Time
+	// time of the scale ups in the last hour
+	wakes []time.Time
+}
+
+// woke records a scale up
+func (s *stabilizer) woke(now time.Time) {
+	s.awakeSince = &now
+	s.sleepSince = nil
+	s.wakes = append(s.wakes, now)
+}
+
+// slept records a scale down
+func (s *stabilizer) slept() {
+	s.awakeSince = nil
+	s.sleepSince = nil
+}
+
+// awake records a decision different from Sleep
+func (s *stabilizer) awake() {
+	s.sleepSince = nil
+}
+
+// canSleep records a Sleep decision and returns an empty string if the
+// deployment can be scaled down or the reason to postpone the scale down
+func (s *stabilizer) canSleep(now time.Time) string {
+	if s.sleepSince == nil {
+		s.sleepSince = &now
+	}
+
+	if s.awakeSince != nil && now.Before(s.awakeSince.Add(s.MinAwake)) {
+		return fmt.Sprintf("minimum awake time of %v since %v", s.MinAwake, s.awakeSince.Format(time.RFC3339))
+	}
+
+	if sleepAfter := s.sleepSince.Add(s.window(now)); now.Before(sleepAfter) {
+		if s.flapping(now) {
+			return fmt.Sprintf("flapping (%v wakes in the last hour), sleep after %v", s.wakesSince(now), sleepAfter.Format(time.RFC3339))
+		}
+
+		return fmt.Sprintf("stabilization window, sleep after %v", sleepAfter.Format(time.RFC3339))
+	}
+
+	return ""
+}
+
+// window returns the time the policies must decide Sleep before scaling down
+func (s *stabilizer) window(now time.Time) time.Duration {
+	if s.flapping(now) {
+		return s.Window + s.FlapIdleExtension
+	}
+
+	return s.Window
+}
+
+// wakesSince returns the number of scale ups in the last hour, removing the older ones
+func (s *stabilizer) wakesSince(now time.Time) int {
+	cutoff := now.Add(-flapPeriod)
+
+	first := 0
+	for first < len(s.wakes) && !s.wakes[first].After(cutoff) {
+		first++
+	}
+
+	s.wakes = s.wakes[first:]
+
+	return len(s.wakes)
+}
+
+func (s *stabilizer) flapping(now time.Time) bool {
+	return s.FlapMaxWakes > 0 && s.wakesSince(now) > s.FlapMaxWakes
+}
+
+// status returns the stabilization of the deployment
+func (s *stabilizer) status(now time.Time) Status {
+	status := Status{
+		AwakeSince:        s.awakeSince,
+		SleepPendingSince: s.sleepSince,
+		WakesLastHour:     s.wakesSince(now),
+		Flapping:          s.flapping(now),
+	}
+
+	if s.awakeSince != nil && s.MinAwake > 0 {
+		minAwakeUntil := s.awakeSince.Add(s.MinAwake)
+		status.MinAwakeUntil = &minAwakeUntil
+	}
+
+	if s.sleepSince != nil {
+		sleepAfter := s.sleepSince.Add(s.window(now))
+		status.SleepAfter = &sleepAfter
+	}
+
+	if status.Flapping && s.FlapIdleExtension > 0 {
+		status.IdleExtension = s.FlapIdleExtension.String()
+	}
+
+	return status
+}
@@ -0,0 +1,181 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// tracesPath path of the OTLP/HTTP endpoint receiving spans
+	tracesPath = "/v1/traces"
+
+	scopeName = "github.com/aledbf/horus-proxy"
+
+	statusCodeError = 2
+)
+
+// Exporter sends spans to a tracing backend
+type Exporter interface {
+	Export(spans []*Span) error
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector using OTLP/HTTP with JSON encoding
+type OTLPExporter struct {
+	endpoint string
+	resource map[string]string
+	client   *http.Client
+}
+
+// NewOTLPExporter returns an exporter that sends the spans to the collector in endpoint,
+// i.e. http://otel-collector:4318. The resource attributes identify the proxy in the spans.
+func NewOTLPExporter(endpoint string, resource map[string]string) *OTLPExporter {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(endpoint, tracesPath) {
+		endpoint = endpoint + tracesPath
+	}
+
+	return &OTLPExporter{
+		endpoint: endpoint,
+		resource: resource,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Export sends the spans to the collector
+func (e *OTLPExporter) Export(spans []*Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code %v exporting spans: %s", resp.StatusCode, data)
+	}
+
+	return nil
+}
+
+// the types below are the JSON representation of the OTLP ExportTraceServiceRequest
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Links             []Link          `json:"links,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *OTLPExporter) request(spans []*Span) *otlpRequest {
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        attributes(span.Attributes),
+			Links:             span.Links,
+		}
+
+		if span.Error != "" {
+			s.Status = &otlpStatus{Code: statusCodeError, Message: span.Error}
+		}
+
+		otlpSpans = append(otlpSpans, s)
+	}
+
+	return &otlpRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{Attributes: attributes(e.resource)},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: scopeName},
+						Spans: otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+// attributes returns the attributes sorted by key
+func attributes(values map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, otlpAttribute{Key: key, Value: otlpValue{StringValue: values[key]}})
+	}
+
+	return attrs
+}
@@ -0,0 +1,96 @@
+// Package tracing records spans of the activation of the deployment and
+// exports them, together with the spans recorded by NGINX, to an
+// OpenTelemetry collector. Traces are identified using W3C trace context.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// SpanKind describes the relationship between the span and its parent
+type SpanKind int
+
+const (
+	// SpanKindInternal is an operation internal to the proxy
+	SpanKindInternal SpanKind = 1
+	// SpanKindServer is a request received by the proxy
+	SpanKindServer SpanKind = 2
+	// SpanKindClient is a request sent by the proxy
+	SpanKindClient SpanKind = 3
+)
+
+// Link references a span of another trace
+type Link struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+// Span is an operation of a trace
+type Span struct {
+	// TraceID hex encoded identifier of the trace (16 bytes)
+	TraceID string `json:"traceId"`
+	// SpanID hex encoded identifier of the span (8 bytes)
+	SpanID string `json:"spanId"`
+	// ParentSpanID hex encoded identifier of the parent span. Empty for root spans
+	ParentSpanID string `json:"parentSpanId,omitempty"`
+
+	Name string   `json:"name"`
+	Kind SpanKind `json:"kind"`
+
+	Start time.Time `json:"-"`
+	End   time.Time `json:"-"`
+
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Links      []Link            `json:"links,omitempty"`
+
+	// Error description of the error of the operation. Empty if it was successful
+	Error string `json:"error,omitempty"`
+}
+
+// UnmarshalJSON decodes a span recorded by NGINX, where the start and
+// end of the span are unix times in seconds
+func (s *Span) UnmarshalJSON(data []byte) error {
+	type span Span
+	aux := &struct {
+		*span
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+	}{
+		span: (*span)(s),
+	}
+
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+
+	s.Start = unixTime(aux.Start)
+	s.End = unixTime(aux.End)
+
+	return nil
+}
+
+func unixTime(seconds float64) time.Time {
+	sec, dec := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(dec*1e9))
+}
+
+// NewTraceID returns a random trace identifier
+func NewTraceID() string {
+	return randomHex(16)
+}
+
+// NewSpanID returns a random span identifier
+func NewSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(size int) string {
+	b := make([]byte, size)
+	// the error is ignored because crypto/rand never fails on Linux
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/aledbf/horus-proxy/pkg/nginx"
+)
+
+const (
+	spansPath = "/spans"
+
+	// maxQueuedSpans spans kept while the collector is not available
+	maxQueuedSpans = 10000
+)
+
+var log = logf.Log.WithName("controller").WithName("tracing")
+
+// dataPlaneSpans is the document returned by the NGINX status server in /spans
+type dataPlaneSpans struct {
+	Spans []*Span `json:"spans"`
+}
+
+// Tracer queues the spans recorded by the controller and periodically
+// exports them with the spans recorded by NGINX
+type Tracer struct {
+	exporter Exporter
+
+	mu    sync.Mutex
+	queue []*Span
+
+	// fetchSpans returns the spans recorded by NGINX since the last call
+	fetchSpans func() ([]*Span, error)
+}
+
+// NewTracer returns a tracer that sends the spans using an exporter
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{
+		exporter:   exporter,
+		fetchSpans: getDataPlaneSpans,
+	}
+}
+
+// Record queues a span to be exported
+func (t *Tracer) Record(span *Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.enqueue(span)
+}
+
+func (t *Tracer) enqueue(spans ...*Span) {
+	t.queue = append(t.queue, spans...)
+	if dropped := len(t.queue) - maxQueuedSpans; dropped > 0 {
+		log.Info("Dropping spans, the queue is full", "dropped", dropped)
+		t.queue = t.queue[dropped:]
+	}
+}
+
+// Flush exports the queued spans and the spans recorded by NGINX
+func (t *Tracer) Flush() error {
+	spans, err := t.fetchSpans()
+	if err != nil {
+		log.Error(err, "obtaining spans from NGINX")
+	}
+
+	t.mu.Lock()
+	t.enqueue(spans...)
+	queue := t.queue
+	t.queue = nil
+	t.mu.Unlock()
+
+	err = t.exporter.Export(queue)
+	if err != nil {
+		// spans are exported in the next flush
+		// the queue contains the spans recorded during the export
+		t.mu.Lock()
+		t.queue = append(queue, t.queue...)
+		t.enqueue()
+		t.mu.Unlock()
+	}
+
+	return err
+}
+
+// Start periodically exports the spans until the channel is closed
+func (t *Tracer) Start(stopCh <-chan struct{}) {
+	for c := time.Tick(5 * time.Second); ; {
+		select {
+		case <-c:
+			if err := t.Flush(); err != nil {
+				log.Error(err, "exporting spans")
+			}
+		case <-stopCh:
+			if err := t.Flush(); err != nil {
+				log.Error(err, "exporting spans")
+			}
+			return
+		}
+	}
+}
+
+func getDataPlaneSpans() ([]*Span, error) {
+	statusCode, data, err := nginx.NewGetStatusRequest(spansPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %v obtaining spans", statusCode)
+	}
+
+	spans := &dataPlaneSpans{}
+	err = json.Unmarshal(data, spans)
+	if err != nil {
+		return nil, err
+	}
+
+	return spans.Spans, nil
+}
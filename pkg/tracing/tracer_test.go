@@ -0,0 +1,167 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTracerFlush(t *testing.T) {
+	var received []*otlpRequest
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != tracesPath {
+			t.Errorf("unexpected path %v", r.URL.Path)
+		}
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		request := &otlpRequest{}
+		if err := json.Unmarshal(data, request); err != nil {
+			t.Errorf("unexpected error decoding request: %v", err)
+		}
+
+		received = append(received, request)
+	}))
+	defer collector.Close()
+
+	held := `{"spans":[{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7",
+		"parentSpanId":"a3ce929d0e0e4736","name":"held","kind":1,"start":1561370400.5,"end":1561370430,
+		"attributes":{"horus.backend":"default-http-svc-8080"}}]}`
+
+	tracer := NewTracer(NewOTLPExporter(collector.URL, map[string]string{"service.name": "horus-proxy"}))
+	tracer.fetchSpans = func() ([]*Span, error) {
+		spans := &dataPlaneSpans{}
+		err := json.Unmarshal([]byte(held), spans)
+		return spans.Spans, err
+	}
+
+	tracer.Record(&Span{
+		TraceID:      "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:       "b7ad6b7169203331",
+		ParentSpanID: "00f067aa0ba902b7",
+		Name:         "scale",
+		Kind:         SpanKindInternal,
+		Start:        time.Unix(1561370401, 0),
+		End:          time.Unix(1561370429, 0),
+		Error:        "timed out waiting for the condition",
+	})
+
+	if err := tracer.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(received) != 1 {
+		t.Fatalf("expected one request but got %v", len(received))
+	}
+
+	resource := received[0].ResourceSpans[0].Resource.Attributes
+	if !reflect.DeepEqual(resource, []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: "horus-proxy"}}}) {
+		t.Errorf("unexpected resource attributes %+v", resource)
+	}
+
+	expected := []otlpSpan{
+		{
+			TraceID:           "4bf92f3577b34da6a3ce929d0e0e4736",
+			SpanID:            "b7ad6b7169203331",
+			ParentSpanID:      "00f067aa0ba902b7",
+			Name:              "scale",
+			Kind:              SpanKindInternal,
+			StartTimeUnixNano: "1561370401000000000",
+			EndTimeUnixNano:   "1561370429000000000",
+			Attributes:        []otlpAttribute{},
+			Status:            &otlpStatus{Code: statusCodeError, Message: "timed out waiting for the condition"},
+		},
+		{
+			TraceID:           "4bf92f3577b34da6a3ce929d0e0e4736",
+			SpanID:            "00f067aa0ba902b7",
+			ParentSpanID:      "a3ce929d0e0e4736",
+			Name:              "held",
+			Kind:              SpanKindInternal,
+			StartTimeUnixNano: "1561370400500000000",
+			EndTimeUnixNano:   "1561370430000000000",
+			Attributes:        []otlpAttribute{{Key: "horus.backend", Value: otlpValue{StringValue: "default-http-svc-8080"}}},
+		},
+	}
+
+	spans := received[0].ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != len(expected) {
+		t.Fatalf("expected %v spans but got %v", len(expected), len(spans))
+	}
+
+	for i := range expected {
+		// empty attributes are omitted in the request
+		if len(spans[i].Attributes) == 0 {
+			spans[i].Attributes = []otlpAttribute{}
+		}
+
+		if !reflect.DeepEqual(spans[i], expected[i]) {
+			t.Errorf("%v: expected %+v but got %+v", i, expected[i], spans[i])
+		}
+	}
+
+	// the queue is empty after a successful export
+	tracer.fetchSpans = func() ([]*Span, error) { return nil, nil }
+	if err := tracer.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(received) != 1 {
+		t.Errorf("expected no request without spans but got %v", len(received)-1)
+	}
+}
+
+func TestTracerFlushError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	tracer := NewTracer(NewOTLPExporter(collector.URL, nil))
+	tracer.fetchSpans = func() ([]*Span, error) { return nil, nil }
+
+	tracer.Record(&Span{TraceID: NewTraceID(), SpanID: NewSpanID(), Name: "scale"})
+	if err := tracer.Flush(); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if len(tracer.queue) != 1 {
+		t.Errorf("expected the span to be kept in the queue but got %v spans", len(tracer.queue))
+	}
+}
+
+type exporterFunc func(spans []*Span) error
+
+func (f exporterFunc) Export(spans []*Span) error {
+	return f(spans)
+}
+
+func TestTracerFlushErrorKeepsOrder(t *testing.T) {
+	first := &Span{TraceID: NewTraceID(), SpanID: NewSpanID(), Name: "first"}
+	second := &Span{TraceID: NewTraceID(), SpanID: NewSpanID(), Name: "second"}
+
+	var tracer *Tracer
+	tracer = NewTracer(exporterFunc(func(spans []*Span) error {
+		// a span recorded while the queue is exported
+		tracer.Record(second)
+		return fmt.Errorf("unavailable")
+	}))
+	tracer.fetchSpans = func() ([]*Span, error) { return nil, nil }
+
+	tracer.Record(first)
+	if err := tracer.Flush(); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if !reflect.DeepEqual(tracer.queue, []*Span{first, second}) {
+		t.Errorf("expected the spans in the order they were recorded but got %v", tracer.queue)
+	}
+}
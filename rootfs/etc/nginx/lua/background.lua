@@ -0,0 +1,124 @@
+local iputils = require("resty.iputils")
+local forwarded = require("forwarded")
+
+local _M = {}
+
+-- paths, user agents and wake of the Background struct in pkg/nginx/types.go
+local config = {
+  paths = {},
+  userAgents = {},
+  wake = false,
+}
+
+-- parsed CIDRs of the clients
+local cidrs = {}
+
+-- headers to match, by lowercase name. The value is false if only the presence is checked
+local headers = {}
+
+local function list(value)
+  if type(value) == "table" then
+    return value
+  end
+
+  return {}
+end
+
+function _M.configure(new_config)
+  if not new_config then
+    return
+  end
+
+  local parsed, err = iputils.parse_cidrs(list(new_config.cidrs))
+  if not parsed then
+    ngx.log(ngx.ERR, "could not parse background CIDRs: ", err)
+    return
+  end
+
+  local new_headers = {}
+  for _, header in ipairs(list(new_config.headers)) do
+    local name, value = header:match("^([^=]+)=(.*)$")
+    if name then
+      new_headers[name:lower()] = value
+    else
+      new_headers[header:lower()] = false
+    end
+  end
+
+  config = {
+    paths = list(new_config.paths),
+    userAgents = list(new_config.userAgents),
+    wake = new_config.wake == true,
+  }
+  cidrs = parsed
+  headers = new_headers
+end
+
+local function has_prefix(value, prefixes)
+  for _, prefix in ipairs(prefixes) do
+    if value:sub(1, #prefix) == prefix then
+      return true
+    end
+  end
+
+  return false
+end
+
+local function contains(value, substrings)
+  for _, substring in ipairs(substrings) do
+    if value:find(substring, 1, true) then
+      return true
+    end
+  end
+
+  return false
+end
+
+local function header_matches(request_headers)
+  for name, expected in pairs(headers) do
+    local value = request_headers[name]
+    if type(value) == "table" then
+      value = table.concat(value, ", ")
+    end
+
+    if value and (not expected or value == expected) then
+      return true
+    end
+  end
+
+  return false
+end
+
+local function matches()
+  if has_prefix(ngx.var.uri or "", config.paths) then
+    return true
+  end
+
+  if contains(ngx.var.http_user_agent or "", config.userAgents) then
+    return true
+  end
+
+  -- only IPv4 addresses are supported by iputils
+  if #cidrs > 0 and iputils.ip_in_cidrs(forwarded.client_ip(), cidrs) == true then
+    return true
+  end
+
+  return next(headers) ~= nil and header_matches(ngx.req.get_headers())
+end
+
+-- is_background returns true if the request is not activity of the deployment,
+-- i.e. probes and monitoring. Must be called once the client address is known
+function _M.is_background()
+  if ngx.ctx.background == nil then
+    ngx.ctx.background = matches()
+  end
+
+  return ngx.ctx.background
+end
+
+-- can_wake returns true if background requests are allowed to wake the deployment
+function _M.can_wake()
+  return config.wake
+end
+
+return _M
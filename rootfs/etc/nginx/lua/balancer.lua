@@ -1,7 +1,15 @@
 local ngx_balancer = require("ngx.balancer")
 local cjson = require("cjson.safe")
+local background = require("background")
 local configuration = require("configuration")
+local forwarded = require("forwarded")
+local outlier_detection = require("outlier_detection")
 local round_robin = require("balancer.round_robin")
+local slow_start = require("slow_start")
+local stats = require("stats")
+local sticky_ip = require("balancer.sticky_ip")
+local tracing = require("tracing")
+local util = require("util")
 
 -- measured in seconds
 -- for an Nginx worker to pick up the new list of upstream peers
@@ -10,6 +18,7 @@ local BACKENDS_SYNC_INTERVAL = 1
 
 local _M = {}
 local balancers = {}
+local general_data
 
 local function format_ipv6_endpoints(endpoints)
   local formatted_endpoints = {}
@@ -23,26 +32,44 @@ local function format_ipv6_endpoints(endpoints)
   return formatted_endpoints
 end
 
+local function get_implementation(backend)
+  local affinity = backend.sessionAffinity
+  if affinity and affinity.type == "ClientIP" then
+    return sticky_ip
+  end
+
+  return round_robin
+end
+
 local function sync_backend(backend)
   if not backend.endpoints or #backend.endpoints == 0 then
     ngx.log(ngx.INFO, string.format("there is no endpoint for backend %s. Removing...", backend.name))
     balancers[backend.name] = nil
     configuration.set_endpoint_count(0)
+    slow_start.sync(backend.name, 0)
     return
   end
 
   configuration.set_endpoint_count(#backend.endpoints)
+  slow_start.sync(backend.name, #backend.endpoints)
 
-  local implementation = round_robin
+  -- every path creating or syncing a balancer uses the same endpoints
+  backend.endpoints = format_ipv6_endpoints(backend.endpoints)
+
+  local implementation = get_implementation(backend)
   local balancer = balancers[backend.name]
 
-  if not balancer then
+  -- every implementation is the metatable of its instances
+  if not balancer or getmetatable(balancer) ~= implementation then
+    if balancer then
+      ngx.log(ngx.INFO, string.format("switching balancer of backend %s from %s to %s",
+        backend.name, balancer.name, implementation.name))
+    end
+
     balancers[backend.name] = implementation:new(backend)
     return
   end
 
-  backend.endpoints = format_ipv6_endpoints(backend.endpoints)
-
   balancer:sync(backend)
 end
 
@@ -72,26 +99,76 @@ local function sync_backends()
   end
 end
 
+local function sync_general()
+  local new_general_data = configuration.get_general_data()
+  if not new_general_data or new_general_data == general_data then
+    return
+  end
+
+  local general, err = cjson.decode(new_general_data)
+  if not general then
+    ngx.log(ngx.ERR, "could not parse general data: ", err)
+    return
+  end
+
+  outlier_detection.configure(general.outlierDetection)
+  slow_start.configure(general.slowStart)
+  forwarded.configure(general.forwarded)
+  tracing.configure(general.tracing)
+  background.configure(general.background)
+
+  general_data = new_general_data
+end
+
+local function sync()
+  sync_general()
+  sync_backends()
+end
+
 local function wait_for_balancer()
   local backend_name = ngx.var.proxy_upstream_name
 
   local balancer
+  local held = false
 
   while true do
     balancer = balancers[backend_name]
-    if not balancer then
+    if not balancer and not held and background.is_background() and not background.can_wake() then
+      -- probes and monitoring must not wake the deployment
+      ngx.log(ngx.DEBUG, "rejecting background request, no upstream servers available in ", backend_name)
+      return ngx.exit(ngx.HTTP_SERVICE_UNAVAILABLE)
+    elseif not balancer then
       local waiting = configuration.get_waiting_for_endpoints()
       if not waiting then
         configuration.set_waiting_for_endpoints(true)
       end
 
+      if not held then
+        stats.hold(backend_name, tracing.hold())
+        held = true
+      else
+        stats.holding()
+      end
+
       ngx.log(ngx.DEBUG, "no upstream servers available in ", backend_name)
       ngx.sleep(math.random(3,7))
+    elseif held and not slow_start.ready(backend_name, util.tablelength(balancer.instance.nodes)) then
+      ngx.log(ngx.DEBUG, "waiting for the minimum number of ready endpoints in ", backend_name)
+      stats.holding()
+      ngx.sleep(1)
     else
       configuration.set_waiting_for_endpoints(false)
       break
     end
   end
+
+  if held then
+    slow_start.pace(backend_name)
+    stats.release()
+    tracing.release()
+  end
+
+  stats.start(backend_name)
 end
 
 local function get_balancer()
@@ -105,10 +182,11 @@ local function get_balancer()
 end
 
 function _M.init_worker()
-  sync_backends() -- when worker starts, sync backends without delay
-  local _, err = ngx.timer.every(BACKENDS_SYNC_INTERVAL, sync_backends)
+  stats.init()
+  sync() -- when worker starts, sync backends without delay
+  local _, err = ngx.timer.every(BACKENDS_SYNC_INTERVAL, sync)
   if err then
-    ngx.log(ngx.ERR, string.format("error when setting up timer.every for sync_backends: %s", tostring(err)))
+    ngx.log(ngx.ERR, string.format("error when setting up timer.every for sync: %s", tostring(err)))
   end
 end
 
@@ -132,7 +210,22 @@ function _M.balance()
     return
   end
 
-  ngx_balancer.set_more_tries(1)
+  -- skip ejected endpoints. If all the endpoints are ejected the
+  -- last one returned by the balancer is used
+  local backend_name = ngx.var.proxy_upstream_name
+  for _ = 1, util.tablelength(balancer.instance.nodes) do
+    if not outlier_detection.is_ejected(backend_name, peer) then
+      break
+    end
+
+    peer = balancer:balance()
+  end
+
+  -- balance is invoked again for every retry
+  if not ngx.ctx.balancer_retries_set then
+    ngx_balancer.set_more_tries(outlier_detection.retries())
+    ngx.ctx.balancer_retries_set = true
+  end
 
   local ok, err = ngx_balancer.set_current_peer(peer)
   if not ok then
@@ -146,6 +239,8 @@ function _M.log()
     return
   end
 
+  outlier_detection.record(ngx.var.proxy_upstream_name, balancer.instance.nodes)
+
   if not balancer.after_balance then
     return
   end
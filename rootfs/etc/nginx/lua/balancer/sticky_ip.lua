@@ -0,0 +1,55 @@
+local balancer_resty = require("balancer.resty")
+local forwarded = require("forwarded")
+local outlier_detection = require("outlier_detection")
+local resty_roundrobin = require("resty.roundrobin")
+local util = require("util")
+
+-- bindings are kept in a shared dictionary instead of the balancer instance
+-- because balancers are removed when a backend has no endpoints and they
+-- must survive a scale from zero
+local affinity_data = ngx.shared.balancer_affinity
+
+local _M = balancer_resty:new({ factory = resty_roundrobin, name = "sticky_ip" })
+
+function _M.new(self, backend)
+  local nodes = util.get_nodes(backend.endpoints)
+  local o = {
+    instance = self.factory:new(nodes),
+    backend_name = backend.name,
+    timeout = backend.sessionAffinity.timeoutSeconds,
+  }
+  setmetatable(o, self)
+  self.__index = self
+  return o
+end
+
+function _M.sync(self, backend)
+  self.timeout = backend.sessionAffinity.timeoutSeconds
+  balancer_resty.sync(self, backend)
+end
+
+local function affinity_key(self, client)
+  return self.backend_name .. ":" .. client
+end
+
+function _M.balance(self)
+  local client = forwarded.client_ip()
+  local key = affinity_key(self, client)
+
+  local peer = affinity_data:get(key)
+  if not peer or not self.instance.nodes[peer] or outlier_detection.is_ejected(self.backend_name, peer) then
+    -- new client, the endpoint it was bound to is gone
+    -- (i.e. the deployment was scaled to zero and back) or is ejected
+    peer = self.instance:find()
+  end
+
+  -- the timeout is refreshed on every request, same as kube-proxy
+  local ok, err = affinity_data:set(key, peer, self.timeout)
+  if not ok then
+    ngx.log(ngx.ERR, string.format("error binding client %s to %s: %s", client, peer, tostring(err)))
+  end
+
+  return peer
+end
+
+return _M
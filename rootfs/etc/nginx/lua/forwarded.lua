@@ -0,0 +1,176 @@
+local iputils = require("resty.iputils")
+
+local _M = {}
+
+-- this is the Lua representation of the Forwarded struct in pkg/nginx/types.go
+local config = {
+  enabled = true,
+  useProxyProtocol = false,
+}
+
+local trusted_cidrs = {}
+
+function _M.configure(new_config)
+  if not new_config then
+    return
+  end
+
+  local cidrs = {}
+  if type(new_config.trustedCIDRs) == "table" then
+    cidrs = new_config.trustedCIDRs
+  end
+
+  local parsed, err = iputils.parse_cidrs(cidrs)
+  if not parsed then
+    ngx.log(ngx.ERR, "could not parse trusted CIDRs: ", err)
+    return
+  end
+
+  config = new_config
+  trusted_cidrs = parsed
+end
+
+local function is_trusted(address)
+  if #trusted_cidrs == 0 then
+    return false
+  end
+
+  -- only IPv4 addresses are supported by iputils
+  local trusted = iputils.ip_in_cidrs(address, trusted_cidrs)
+  return trusted == true
+end
+
+-- peer_address returns the address of the host connected to the proxy
+local function peer_address()
+  if config.useProxyProtocol then
+    local address = ngx.var.proxy_protocol_addr
+    if address and address ~= "" then
+      return address
+    end
+  end
+
+  return ngx.var.remote_addr
+end
+
+local function split_list(value)
+  local list = {}
+  if not value then
+    return list
+  end
+
+  for item in value:gmatch("[^,%s]+") do
+    table.insert(list, item)
+  end
+
+  return list
+end
+
+-- first_header returns the first value of a header sent more than once
+local function first_header(value)
+  if type(value) == "table" then
+    return value[1]
+  end
+
+  return value
+end
+
+-- client_address returns the first address not trusted walking the
+-- chain of proxies in X-Forwarded-For from right to left
+local function client_address(forwarded_for, peer)
+  local addresses = split_list(forwarded_for)
+  for i = #addresses, 1, -1 do
+    if not is_trusted(addresses[i]) then
+      return addresses[i]
+    end
+  end
+
+  if #addresses > 0 then
+    return addresses[1]
+  end
+
+  return peer
+end
+
+local function forwarded_node(address)
+  if address:find(":", 1, true) then
+    -- IPv6 addresses must be quoted (RFC 7239)
+    return string.format('"[%s]"', address)
+  end
+
+  return address
+end
+
+-- forwarded_host returns the host used in the Forwarded header. Hosts with
+-- a port must be quoted (RFC 7239)
+local function forwarded_host(host)
+  if host:find(":", 1, true) then
+    return string.format('"%s"', host)
+  end
+
+  return host
+end
+
+-- rewrite sets the variables used in the template to configure the forwarded headers.
+-- The headers sent by untrusted peers are replaced.
+function _M.rewrite()
+  local peer = peer_address()
+  local headers = ngx.req.get_headers()
+
+  local client = peer
+  local forwarded_for = peer
+  local proto = ngx.var.scheme
+  local host = ngx.var.host
+  local port = ngx.var.server_port
+  -- the host of the Forwarded header is the Host header, including the port
+  local forwarded = string.format("for=%s;proto=%s;host=%s", forwarded_node(peer), proto,
+    forwarded_host(ngx.var.http_host or host))
+
+  if is_trusted(peer) then
+    local incoming_for = headers["x-forwarded-for"]
+    if type(incoming_for) == "table" then
+      incoming_for = table.concat(incoming_for, ", ")
+    end
+
+    if incoming_for then
+      client = client_address(incoming_for, peer)
+      forwarded_for = incoming_for .. ", " .. peer
+    end
+
+    proto = first_header(headers["x-forwarded-proto"]) or proto
+    host = first_header(headers["x-forwarded-host"]) or host
+    port = first_header(headers["x-forwarded-port"]) or port
+
+    local incoming_forwarded = headers["forwarded"]
+    if type(incoming_forwarded) == "table" then
+      incoming_forwarded = table.concat(incoming_forwarded, ", ")
+    end
+
+    if incoming_forwarded then
+      forwarded = incoming_forwarded .. ", " .. forwarded
+    end
+  end
+
+  ngx.var.client_ip = client
+
+  if not config.enabled then
+    return
+  end
+
+  ngx.var.forwarded_for = forwarded_for
+  ngx.var.forwarded_proto = proto
+  ngx.var.forwarded_host = host
+  ngx.var.forwarded_port = port
+  ngx.var.forwarded = forwarded
+end
+
+-- client_ip returns the address of the client once rewrite was executed
+function _M.client_ip()
+  local client = ngx.var.client_ip
+  if not client or client == "" then
+    return ngx.var.remote_addr
+  end
+
+  return client
+end
+
+return _M
@@ -1,13 +1,32 @@
+local background = require("background")
 local configuration = require("configuration")
+local outlier_detection = require("outlier_detection")
+local split = require("util.split")
+local stats = require("stats")
 
 local _M = {}
 
 local last_request_timestamp = ngx.now()
+local ejected_backends = {}
+
+-- methods used as label. Other methods are labelled as other to keep the number of series bounded
+local METHODS = {
+  GET = true, HEAD = true, POST = true, PUT = true, DELETE = true,
+  CONNECT = true, OPTIONS = true, TRACE = true, PATCH = true,
+}
 
 local metric_requests = prometheus:counter(
-    "http_requests_total", "Number of HTTP requests", {"host", "status"})
+    "http_requests_total", "Number of HTTP requests", {"upstream", "method", "status_class"})
 local metric_latency = prometheus:histogram(
-    "http_requests_duration_seconds", "HTTP request latency", {"host"})
+    "http_requests_duration_seconds", "HTTP request latency", {"upstream", "method", "status_class"})
+local metric_upstream_connect = prometheus:histogram(
+    "upstream_connect_duration_seconds", "Time to establish a connection with the endpoint", {"upstream"})
+local metric_upstream_header = prometheus:histogram(
+    "upstream_header_duration_seconds", "Time to receive the response header from the endpoint", {"upstream"})
+local metric_upstream_response = prometheus:histogram(
+    "upstream_response_duration_seconds", "Time to receive the response from the endpoint", {"upstream"})
+local metric_background_requests = prometheus:counter(
+    "http_background_requests_total", "Number of HTTP requests that are not activity (i.e. probes)", {"upstream"})
 local metric_connections = prometheus:gauge(
     "http_connections", "Number of HTTP connections", {"state"})
 local metric_waiting_for_endpoint = prometheus:gauge(
@@ -16,6 +35,8 @@ local metric_last_request = prometheus:gauge(
     "http_requests_seconds_ago", "Number of seconds since the last connection")
 local metric_endpoint_count = prometheus:gauge(
       "endpoint_count", "Number of running endpoints")
+local metric_ejected_endpoints = prometheus:gauge(
+      "upstream_endpoints_ejected", "Number of endpoints ejected due to consecutive failures", {"upstream"})
 
 function _M.collect()
   metric_connections:set(ngx.var.connections_reading, {"reading"})
@@ -34,14 +55,76 @@ function _M.collect()
 
   metric_waiting_for_endpoint:set(waiting)
 
+  -- there is no way to remove a label so backends without
+  -- ejected endpoints must report zero
+  local ejected = outlier_detection.ejected_endpoints()
+  for backend_name, _ in pairs(ejected_backends) do
+    if not ejected[backend_name] then
+      metric_ejected_endpoints:set(0, {backend_name})
+    end
+  end
+
+  for backend_name, count in pairs(ejected) do
+    metric_ejected_endpoints:set(count, {backend_name})
+    ejected_backends[backend_name] = true
+  end
+
   prometheus:collect()
 end
 
+-- status_class returns the class of a status code (i.e. 2xx)
+function _M.status_class(status)
+  local code = tonumber(status)
+  if not code or code < 100 or code > 599 then
+    return "unknown"
+  end
+
+  return math.floor(code / 100) .. "xx"
+end
+
+-- method returns the method of the request used as label
+function _M.method(method)
+  if METHODS[method] then
+    return method
+  end
+
+  return "other"
+end
+
+-- upstream_time returns the time of the last endpoint used by the
+-- request (the one that returned the response) from a $upstream_*_time variable
+local function upstream_time(var)
+  return tonumber(split.get_last_value(var))
+end
+
+local function observe(metric, value, labels)
+  if value then
+    metric:observe(value, labels)
+  end
+end
+
 function _M.log()
-  last_request_timestamp = ngx.now()
+  local backend_name = ngx.var.proxy_upstream_name
+  local status_class = _M.status_class(ngx.var.status)
+  local response_time = upstream_time(ngx.var.upstream_response_time)
+
+  -- probes and monitoring do not keep the deployment awake
+  local is_background = background.is_background()
+  if is_background then
+    metric_background_requests:inc(1, {backend_name})
+  else
+    last_request_timestamp = ngx.now()
+  end
+
+  stats.log(backend_name, status_class, response_time, is_background)
+
+  local labels = {backend_name, _M.method(ngx.var.request_method), status_class}
+  metric_requests:inc(1, labels)
+  metric_latency:observe(tonumber(ngx.var.request_time), labels)
 
-  metric_requests:inc(1, {ngx.var.server_name, ngx.var.status})
-  metric_latency:observe(tonumber(ngx.var.request_time), {ngx.var.server_name})
+  observe(metric_upstream_connect, upstream_time(ngx.var.upstream_connect_time), {backend_name})
+  observe(metric_upstream_header, upstream_time(ngx.var.upstream_header_time), {backend_name})
+  observe(metric_upstream_response, response_time, {backend_name})
 end
 
 return _M
@@ -0,0 +1,141 @@
+local split = require("util.split")
+local util = require("util")
+
+-- consecutive failures and ejections are shared between workers.
+-- Keys:
+--   failures:<backend>:<peer> number of consecutive failures
+--   ejected:<backend>:<peer>  present while the endpoint is ejected (expires)
+local outlier_data = ngx.shared.outlier_detection
+
+local _M = {}
+
+-- this is the Lua representation of the OutlierDetection struct in pkg/nginx/types.go
+local config = {
+  consecutiveFailures = 0,
+  ejectionSeconds = 30,
+  maxEjectionPercent = 50,
+  retries = 1,
+}
+
+local metric_ejections = prometheus:counter(
+    "upstream_endpoint_ejections_total", "Number of endpoints ejected due to consecutive failures", {"upstream"})
+
+function _M.configure(new_config)
+  if not new_config then
+    return
+  end
+
+  config = new_config
+end
+
+function _M.retries()
+  return config.retries
+end
+
+local function failures_key(backend_name, peer)
+  return "failures:" .. backend_name .. ":" .. peer
+end
+
+local function ejected_key(backend_name, peer)
+  return "ejected:" .. backend_name .. ":" .. peer
+end
+
+function _M.is_ejected(backend_name, peer)
+  return outlier_data:get(ejected_key(backend_name, peer)) ~= nil
+end
+
+local function ejected_count(backend_name, nodes)
+  local count = 0
+  for peer, _ in pairs(nodes) do
+    if _M.is_ejected(backend_name, peer) then
+      count = count + 1
+    end
+  end
+  return count
+end
+
+local function can_eject(backend_name, nodes)
+  local total = util.tablelength(nodes)
+  if total == 0 then
+    return false
+  end
+
+  -- count the endpoint that is about to be ejected
+  local ejected = ejected_count(backend_name, nodes) + 1
+  return (ejected * 100 / total) <= config.maxEjectionPercent
+end
+
+local function eject(backend_name, peer, nodes)
+  if not can_eject(backend_name, nodes) then
+    ngx.log(ngx.WARN, string.format("endpoint %s of backend %s is failing but the maximum ejection percent was reached",
+      peer, backend_name))
+    return
+  end
+
+  local ok, err = outlier_data:set(ejected_key(backend_name, peer), true, config.ejectionSeconds)
+  if not ok then
+    ngx.log(ngx.ERR, string.format("error ejecting endpoint %s: %s", peer, tostring(err)))
+    return
+  end
+
+  ngx.log(ngx.WARN, string.format("ejecting endpoint %s of backend %s for %s seconds after %s consecutive failures",
+    peer, backend_name, config.ejectionSeconds, config.consecutiveFailures))
+
+  metric_ejections:inc(1, {backend_name})
+end
+
+local function is_failure(status)
+  local code = tonumber(status)
+  -- no status means the connection to the upstream failed
+  return not code or code >= 500
+end
+
+-- record updates the consecutive failures of the endpoints used in the
+-- current request. This must be called in the log phase.
+function _M.record(backend_name, nodes)
+  if config.consecutiveFailures <= 0 then
+    return
+  end
+
+  local addrs = split.split_upstream_var(ngx.var.upstream_addr)
+  local statuses = split.split_upstream_var(ngx.var.upstream_status)
+  if not addrs then
+    return
+  end
+
+  for i, peer in ipairs(addrs) do
+    -- only endpoints of the backend (i.e. not the placeholder or an old endpoint)
+    if nodes[peer] then
+      local key = failures_key(backend_name, peer)
+
+      if is_failure(statuses and statuses[i]) then
+        local failures, err = outlier_data:incr(key, 1, 0)
+        if not failures then
+          ngx.log(ngx.ERR, "error counting failures: " .. tostring(err))
+        elseif failures >= config.consecutiveFailures then
+          outlier_data:delete(key)
+          eject(backend_name, peer, nodes)
+        end
+      else
+        outlier_data:delete(key)
+      end
+    end
+  end
+end
+
+-- ejected_endpoints returns the number of ejected endpoints by backend
+function _M.ejected_endpoints()
+  local ejected = {}
+
+  local keys = outlier_data:get_keys(0)
+  for _, key in ipairs(keys) do
+    local backend_name = key:match("^ejected:([^:]+):")
+    if backend_name then
+      ejected[backend_name] = (ejected[backend_name] or 0) + 1
+    end
+  end
+
+  return ejected
+end
+
+return _M
@@ -0,0 +1,116 @@
+-- state of the last activation (scale from zero) of every backend.
+-- Keys:
+--   activated_at:<backend> time the first endpoint was available
+--   released_at:<backend>  time held requests started to be released
+--   release_slot:<backend> number of held requests released since the activation
+--   empty:<backend>        set while the backend does not have endpoints
+local slow_start_data = ngx.shared.slow_start
+
+local _M = {}
+
+-- this is the Lua representation of the SlowStart struct in pkg/nginx/types.go
+local config = {
+  windowSeconds = 0,
+  minReadyEndpoints = 1,
+  releaseRate = 0,
+}
+
+function _M.configure(new_config)
+  if not new_config then
+    return
+  end
+
+  config = new_config
+end
+
+local function key(name, backend_name)
+  return name .. ":" .. backend_name
+end
+
+local function activated(backend_name)
+  slow_start_data:set(key("activated_at", backend_name), ngx.now())
+  slow_start_data:delete(key("released_at", backend_name))
+  slow_start_data:set(key("release_slot", backend_name), 0)
+end
+
+local function deactivated(backend_name)
+  slow_start_data:set(key("empty", backend_name), 1)
+  slow_start_data:delete(key("activated_at", backend_name))
+  slow_start_data:delete(key("released_at", backend_name))
+  slow_start_data:delete(key("release_slot", backend_name))
+end
+
+-- sync must be called by every worker with the endpoints of the backend. The state of the
+-- activation only changes when the backend goes from zero to at least one endpoint, not
+-- when a worker starts (i.e. after a reload) or syncs a backend that already had endpoints
+function _M.sync(backend_name, endpoint_count)
+  if endpoint_count == 0 then
+    deactivated(backend_name)
+    return
+  end
+
+  -- incr is atomic: only the first worker that sees the endpoints gets 2
+  local count = slow_start_data:incr(key("empty", backend_name), 1)
+  if count == 2 then
+    slow_start_data:delete(key("empty", backend_name))
+    activated(backend_name)
+  end
+end
+
+local function window_expired(backend_name)
+  if config.windowSeconds <= 0 then
+    return true
+  end
+
+  local activated_at = slow_start_data:get(key("activated_at", backend_name))
+  if not activated_at then
+    return true
+  end
+
+  return ngx.now() - activated_at >= config.windowSeconds
+end
+
+-- ready returns true if held requests can be released
+function _M.ready(backend_name, endpoint_count)
+  if endpoint_count < config.minReadyEndpoints and not window_expired(backend_name) then
+    return false
+  end
+
+  -- only the first call after the activation sets the time
+  slow_start_data:add(key("released_at", backend_name), ngx.now())
+  return true
+end
+
+-- pace delays a held request to release at most releaseRate requests per second
+-- until the slow start window expires
+function _M.pace(backend_name)
+  if config.releaseRate <= 0 then
+    return
+  end
+
+  local released_at = slow_start_data:get(key("released_at", backend_name))
+  if not released_at then
+    return
+  end
+
+  local slot, err = slow_start_data:incr(key("release_slot", backend_name), 1, 0)
+  if not slot then
+    ngx.log(ngx.ERR, "error pacing held request: " .. tostring(err))
+    return
+  end
+
+  local release_at = released_at + (slot - 1) / config.releaseRate
+
+  local activated_at = slow_start_data:get(key("activated_at", backend_name))
+  if activated_at and config.windowSeconds > 0 then
+    release_at = math.min(release_at, activated_at + config.windowSeconds)
+  end
+
+  local delay = release_at - ngx.now()
+  if delay > 0 then
+    ngx.log(ngx.DEBUG, string.format("delaying held request for %s seconds in %s", delay, backend_name))
+    ngx.sleep(delay)
+  end
+end
+
+return _M
@@ -0,0 +1,324 @@
+-- a dedicated instance: the encoding options of the shared module are global
+local cjson = require("cjson.safe").new()
+local configuration = require("configuration")
+local outlier_detection = require("outlier_detection")
+
+-- stats of the backends shared between workers.
+-- Keys:
+--   active:<backend>            number of requests being processed by the endpoints
+--   last_request:<backend>      time of the last request
+--   requests:<backend>          number of requests processed
+--   errors:<backend>            number of requests with status >= 500
+--   <class>:<backend>           number of requests by status class (i.e. 2xx:<backend>)
+--   upstream_time:<backend>     sum of the response time of the endpoints
+--   upstream_requests:<backend> number of requests with a response from the endpoints
+--   background:<backend>        number of requests that are not activity (i.e. probes)
+local stats_data = ngx.shared.stats
+
+-- requests waiting for endpoints, by the unique ID generated by NGINX.
+-- The number of held requests of a backend is the number of entries
+local held_requests_data = ngx.shared.held_requests
+
+-- held requests refresh their entry while waiting. Entries of requests whose release
+-- is never recorded (i.e. the worker was stopped by a reload) expire
+local HELD_REQUEST_TTL = 30
+
+-- the wake trigger is kept until a request is released
+local WAKE_TRIGGER_TTL = 3600
+
+-- key of the first held request, the one that triggers the activation of the deployment
+local WAKE_TRIGGER_KEY = "wake_trigger"
+
+-- released requests are kept to report the time they waited for endpoints
+local RELEASED_PREFIX = "released:"
+local RELEASED_REQUEST_TTL = 60
+
+-- status classes reported by collect
+local STATUS_CLASSES = { "1xx", "2xx", "3xx", "4xx", "5xx" }
+
+-- version of the document returned by collect.
+-- Must be increased when a field is removed or changes its meaning.
+local VERSION = 1
+
+-- an empty list must be encoded as an array
+cjson.encode_empty_table_as_object(false)
+
+local _M = {}
+
+local function key(name, backend_name)
+  return name .. ":" .. backend_name
+end
+
+local function incr(name, backend_name, value)
+  local _, err = stats_data:incr(key(name, backend_name), value, 0)
+  if err then
+    ngx.log(ngx.ERR, string.format("error updating %s stats: %s", name, tostring(err)))
+  end
+end
+
+function _M.init()
+  -- requests are idle since the proxy started
+  stats_data:safe_add("started_at", ngx.now())
+end
+
+-- hold must be called when a request starts waiting for endpoints.
+-- The span contains the identifiers of the request returned by tracing.hold
+function _M.hold(backend_name, span)
+  local data, err = cjson.encode({
+    id = span.request_id or ngx.var.request_id,
+    backend = backend_name,
+    method = ngx.var.request_method,
+    host = ngx.var.host,
+    path = ngx.var.uri,
+    userAgent = ngx.var.http_user_agent,
+    client = ngx.var.client_ip,
+    start = ngx.now(),
+    traceId = span.trace_id,
+    spanId = span.span_id,
+    sampled = span.sampled or false,
+  })
+  if not data then
+    ngx.log(ngx.ERR, "error encoding held request: ", err)
+    return
+  end
+
+  -- the request is released in the log phase if it does not reach release (i.e. the client closed the connection)
+  ngx.ctx.stats_held = data
+  _M.holding()
+
+  -- only the first held request is recorded until the deployment is active
+  local _, add_err = held_requests_data:safe_add(WAKE_TRIGGER_KEY, data, WAKE_TRIGGER_TTL)
+  if add_err and add_err ~= "exists" then
+    ngx.log(ngx.ERR, "error recording wake trigger: ", add_err)
+  end
+end
+
+-- holding must be called periodically while a held request waits for endpoints
+function _M.holding()
+  local data = ngx.ctx.stats_held
+  if not data then
+    return
+  end
+
+  local ok, err = held_requests_data:set(ngx.var.request_id, data, HELD_REQUEST_TTL)
+  if not ok then
+    ngx.log(ngx.ERR, "error recording held request: ", err)
+  end
+end
+
+-- release must be called when a held request stops waiting for endpoints
+function _M.release()
+  if not ngx.ctx.stats_held then
+    return
+  end
+
+  local request = cjson.decode(ngx.ctx.stats_held)
+  ngx.ctx.stats_held = nil
+  held_requests_data:delete(ngx.var.request_id)
+
+  if request then
+    request.released = ngx.now()
+
+    local data = cjson.encode(request)
+    local ok, err = held_requests_data:set(RELEASED_PREFIX .. ngx.var.request_id, data, RELEASED_REQUEST_TTL)
+    if not ok then
+      ngx.log(ngx.ERR, "error recording released request: ", err)
+    end
+  end
+
+  -- the backend is active again
+  held_requests_data:delete(WAKE_TRIGGER_KEY)
+end
+
+-- start must be called when the request is sent to the endpoints
+function _M.start(backend_name)
+  incr("active", backend_name, 1)
+  ngx.ctx.stats_active = true
+end
+
+-- log must be called in the log phase with the status class of the
+-- request, the response time of the endpoint (nil without response) and
+-- if the request is not activity of the deployment (i.e. probes)
+function _M.log(backend_name, status_class, response_time, is_background)
+  -- the request stopped waiting without reaching the endpoints
+  _M.release()
+
+  if ngx.ctx.stats_active then
+    incr("active", backend_name, -1)
+  end
+
+  if is_background then
+    incr("background", backend_name, 1)
+    return
+  end
+
+  stats_data:set(key("last_request", backend_name), ngx.now())
+
+  incr("requests", backend_name, 1)
+  incr(status_class, backend_name, 1)
+
+  local status = tonumber(ngx.var.status) or 0
+  if status >= 500 then
+    incr("errors", backend_name, 1)
+  end
+
+  if response_time then
+    incr("upstream_time", backend_name, response_time)
+    incr("upstream_requests", backend_name, 1)
+  end
+end
+
+-- backend_names returns the number of endpoints of every backend and the number of
+-- unique addresses of all the endpoints. Every port of a service is a backend with the same pods
+local function backend_names()
+  local names = {}
+  local addresses = {}
+  local unique = 0
+
+  local backends_data = configuration.get_backends_data()
+  if not backends_data then
+    return names, unique
+  end
+
+  local backends, err = cjson.decode(backends_data)
+  if not backends then
+    ngx.log(ngx.ERR, "could not parse backends data: ", err)
+    return names, unique
+  end
+
+  for _, backend in ipairs(backends) do
+    local endpoints = 0
+    if type(backend.endpoints) == "table" then
+      endpoints = #backend.endpoints
+
+      for _, endpoint in ipairs(backend.endpoints) do
+        if not addresses[endpoint.address] then
+          addresses[endpoint.address] = true
+          unique = unique + 1
+        end
+      end
+    end
+
+    names[backend.name] = endpoints
+  end
+
+  return names, unique
+end
+
+-- collect returns the stats of all the backends.
+-- This is the Lua representation of the Stats struct in pkg/metrics/stats.go
+function _M.collect()
+  local started_at = stats_data:get("started_at") or 0
+  local ejected = outlier_detection.ejected_endpoints()
+
+  local held = {}
+  for _, request in ipairs(_M.held_requests()) do
+    held[request.backend] = (held[request.backend] or 0) + 1
+  end
+
+  local names, endpoints_count = backend_names()
+
+  local backends = {}
+  for backend_name, endpoints in pairs(names) do
+    local last_request = stats_data:get(key("last_request", backend_name)) or 0
+
+    local status_classes = {}
+    for _, class in ipairs(STATUS_CLASSES) do
+      status_classes[class] = stats_data:get(key(class, backend_name)) or 0
+    end
+
+    table.insert(backends, {
+      name = backend_name,
+      heldRequests = held[backend_name] or 0,
+      activeRequests = stats_data:get(key("active", backend_name)) or 0,
+      lastRequest = math.max(last_request, started_at),
+      endpoints = endpoints,
+      ejectedEndpoints = ejected[backend_name] or 0,
+      requests = stats_data:get(key("requests", backend_name)) or 0,
+      errors = stats_data:get(key("errors", backend_name)) or 0,
+      statusClasses = status_classes,
+      upstreamTime = stats_data:get(key("upstream_time", backend_name)) or 0,
+      upstreamRequests = stats_data:get(key("upstream_requests", backend_name)) or 0,
+      backgroundRequests = stats_data:get(key("background", backend_name)) or 0,
+    })
+  end
+
+  return {
+    version = VERSION,
+    timestamp = ngx.now(),
+    endpoints = endpoints_count,
+    backends = backends,
+  }
+end
+
+local function requests(released)
+  local list = {}
+
+  local keys = held_requests_data:get_keys(0)
+  for _, key in ipairs(keys) do
+    local is_released = string.sub(key, 1, #RELEASED_PREFIX) == RELEASED_PREFIX
+    local data = key ~= WAKE_TRIGGER_KEY and is_released == released and held_requests_data:get(key)
+    local request = data and cjson.decode(data)
+    if request then
+      table.insert(list, request)
+    end
+  end
+
+  table.sort(list, function(a, b) return a.start < b.start end)
+
+  return list
+end
+
+-- held_requests returns the requests waiting for endpoints.
+-- This is the Lua representation of the HeldRequest struct in pkg/metrics/held.go
+function _M.held_requests()
+  return requests(false)
+end
+
+-- released_requests returns the requests that stopped waiting for endpoints in the last minute
+function _M.released_requests()
+  return requests(true)
+end
+
+-- wake_trigger returns the first held request since the deployment was active
+function _M.wake_trigger()
+  local data = held_requests_data:get(WAKE_TRIGGER_KEY)
+  return data and cjson.decode(data)
+end
+
+function _M.call_held()
+  if ngx.var.request_method ~= "GET" then
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    ngx.print("Only GET requests are allowed!")
+    return
+  end
+
+  ngx.status = ngx.HTTP_OK
+  ngx.header.content_type = "application/json"
+  ngx.print(cjson.encode({
+    requests = _M.held_requests(),
+    released = _M.released_requests(),
+    trigger = _M.wake_trigger(),
+  }))
+end
+
+function _M.call()
+  if ngx.var.request_method ~= "GET" then
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    ngx.print("Only GET requests are allowed!")
+    return
+  end
+
+  local body, err = cjson.encode(_M.collect())
+  if not body then
+    ngx.log(ngx.ERR, "error encoding stats: ", err)
+    ngx.status = ngx.HTTP_INTERNAL_SERVER_ERROR
+    return
+  end
+
+  ngx.status = ngx.HTTP_OK
+  ngx.header.content_type = "application/json"
+  ngx.print(body)
+end
+
+return _M
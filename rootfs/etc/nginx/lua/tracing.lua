@@ -0,0 +1,232 @@
+local cjson = require("cjson.safe")
+local resty_random = require("resty.random")
+local resty_string = require("resty.string")
+
+-- finished spans waiting to be collected by the controller.
+-- Keys:
+--   spans list of JSON encoded spans
+local tracing_data = ngx.shared.tracing
+
+-- spans are dropped when the controller does not collect them
+local MAX_SPANS = 10000
+
+-- maximum number of spans returned by call
+local MAX_SPANS_PER_CALL = 1000
+
+local SPAN_KIND_INTERNAL = 1
+local SPAN_KIND_SERVER = 2
+
+local _M = {}
+
+-- this is the Lua representation of the Tracing struct in pkg/nginx/types.go
+local config = {
+  enabled = false,
+  sampleRatio = 1,
+}
+
+function _M.configure(new_config)
+  if not new_config then
+    return
+  end
+
+  config = new_config
+end
+
+local function random_hex(size)
+  local bytes = resty_random.bytes(size)
+  if not bytes then
+    -- not enough entropy
+    bytes = resty_random.bytes(size, false)
+  end
+
+  return resty_string.to_hex(bytes)
+end
+
+local function is_zero(value)
+  return value:match("^0+$") ~= nil
+end
+
+-- parse_traceparent returns the trace id, parent id and flags of a W3C traceparent header
+local function parse_traceparent(value)
+  if type(value) ~= "string" then
+    return nil
+  end
+
+  local version, trace_id, parent_id, flags = value:match("^(%x%x)%-(%x+)%-(%x+)%-(%x%x)")
+  if not version or version:lower() == "ff" then
+    return nil
+  end
+
+  if #trace_id ~= 32 or #parent_id ~= 16 or is_zero(trace_id) or is_zero(parent_id) then
+    return nil
+  end
+
+  return trace_id:lower(), parent_id:lower(), flags:lower()
+end
+
+local function first_header(value)
+  if type(value) == "table" then
+    return value[1]
+  end
+
+  return value
+end
+
+-- rewrite starts the span of the request, propagating the W3C trace context
+-- and the request ID (X-Request-ID) to the endpoints
+function _M.rewrite()
+  local headers = ngx.req.get_headers()
+
+  local request_id = first_header(headers["x-request-id"])
+  if not request_id or request_id == "" then
+    request_id = ngx.var.request_id
+    ngx.req.set_header("X-Request-ID", request_id)
+  end
+
+  ngx.var.proxy_request_id = request_id
+
+  local trace_id, parent_id, flags = parse_traceparent(first_header(headers["traceparent"]))
+  if not trace_id then
+    trace_id = random_hex(16)
+    parent_id = nil
+    flags = math.random() < config.sampleRatio and "01" or "00"
+  end
+
+  local span_id = random_hex(8)
+
+  ngx.ctx.trace = {
+    trace_id = trace_id,
+    span_id = span_id,
+    parent_id = parent_id,
+    sampled = tonumber(flags, 16) % 2 == 1,
+    request_id = request_id,
+  }
+
+  -- the span of the proxy is the parent of the span of the endpoint
+  ngx.req.set_header("traceparent", string.format("00-%s-%s-%s", trace_id, span_id, flags))
+end
+
+-- hold starts the span of the held phase of the request and returns its identifiers
+function _M.hold()
+  local trace = ngx.ctx.trace
+  if not trace then
+    return {}
+  end
+
+  trace.held = {
+    span_id = random_hex(8),
+    start = ngx.now(),
+  }
+
+  return {
+    request_id = trace.request_id,
+    trace_id = trace.trace_id,
+    span_id = trace.held.span_id,
+    sampled = trace.sampled,
+  }
+end
+
+-- release finishes the span of the held phase of the request
+function _M.release()
+  local trace = ngx.ctx.trace
+  if not trace or not trace.held then
+    return
+  end
+
+  trace.held.finish = ngx.now()
+end
+
+local function push(span)
+  local length = tracing_data:llen("spans") or 0
+  if length >= MAX_SPANS then
+    ngx.log(ngx.WARN, "dropping span, the queue is full")
+    return
+  end
+
+  local data, err = cjson.encode(span)
+  if not data then
+    ngx.log(ngx.ERR, "error encoding span: ", err)
+    return
+  end
+
+  local ok, push_err = tracing_data:rpush("spans", data)
+  if not ok then
+    ngx.log(ngx.ERR, "error queuing span: ", push_err)
+  end
+end
+
+-- log records the spans of the request. This must be called in the log phase
+function _M.log()
+  local trace = ngx.ctx.trace
+  if not config.enabled or not trace or not trace.sampled then
+    return
+  end
+
+  local now = ngx.now()
+  local backend_name = ngx.var.proxy_upstream_name
+
+  push({
+    traceId = trace.trace_id,
+    spanId = trace.span_id,
+    parentSpanId = trace.parent_id,
+    name = ngx.var.request_method,
+    kind = SPAN_KIND_SERVER,
+    start = ngx.req.start_time(),
+    ["end"] = now,
+    attributes = {
+      ["http.method"] = ngx.var.request_method,
+      ["http.target"] = ngx.var.uri,
+      ["http.status_code"] = ngx.var.status,
+      ["http.request_id"] = trace.request_id,
+      ["net.peer.ip"] = ngx.var.client_ip,
+      ["horus.backend"] = backend_name,
+      ["horus.upstream_addr"] = ngx.var.upstream_addr,
+    },
+  })
+
+  if trace.held then
+    push({
+      traceId = trace.trace_id,
+      spanId = trace.held.span_id,
+      parentSpanId = trace.span_id,
+      name = "held",
+      kind = SPAN_KIND_INTERNAL,
+      start = trace.held.start,
+      ["end"] = trace.held.finish or now,
+      attributes = {
+        ["horus.backend"] = backend_name,
+      },
+    })
+  end
+end
+
+-- call returns the finished spans removing them from the queue
+function _M.call()
+  if ngx.var.request_method ~= "GET" then
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    ngx.print("Only GET requests are allowed!")
+    return
+  end
+
+  local spans = {}
+  for _ = 1, MAX_SPANS_PER_CALL do
+    local data = tracing_data:lpop("spans")
+    if not data then
+      break
+    end
+
+    local span = cjson.decode(data)
+    if span then
+      table.insert(spans, span)
+    end
+  end
+
+  -- an empty list must be encoded as an array
+  cjson.encode_empty_table_as_object(false)
+
+  ngx.status = ngx.HTTP_OK
+  ngx.header.content_type = "application/json"
+  ngx.print(cjson.encode({ spans = spans }))
+end
+
+return _M